@@ -0,0 +1,159 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/rightscale/rsc.v4/rsapi"
+)
+
+const (
+	authPasswordVariable      = "RSRDP_RIGHTSCALE_PASSWORD"
+	authInstanceTokenVariable = "RS_API_TOKEN"
+)
+
+type AuthConfig struct {
+	Mode           string
+	Email          string
+	Password       string
+	PasswordEnv    string `mapstructure:"password_env"`
+	AccessToken    string `mapstructure:"access_token"`
+	AccessTokenEnv string `mapstructure:"access_token_env"`
+	InstanceToken  string `mapstructure:"instance_token"`
+}
+
+func (environment *Environment) CheckAuth() error {
+	switch environment.Auth.Mode {
+	case "", "refresh_token":
+		if environment.RefreshToken == "" && len(environment.RefreshTokenCommand) == 0 && environment.RefreshTokenEnv == "" && environment.RefreshTokenFile == "" {
+			return fmt.Errorf("missing refresh_token, refresh_token_command, refresh_token_env or refresh_token_file")
+		}
+	case "password":
+		if environment.Auth.Email == "" {
+			return fmt.Errorf("auth: missing email for password mode")
+		}
+	case "access_token":
+		if environment.Auth.AccessToken == "" && environment.Auth.AccessTokenEnv == "" {
+			return fmt.Errorf("auth: missing access_token or access_token_env for access_token mode")
+		}
+	case "instance":
+		if environment.allAccounts || len(environment.accounts) != 0 {
+			return fmt.Errorf("accounts: cannot be used with the instance auth mode")
+		}
+	default:
+		return fmt.Errorf("auth: unsupported mode: %s", environment.Auth.Mode)
+	}
+
+	return nil
+}
+
+func (environment *Environment) authenticator() (rsapi.Authenticator, error) {
+	if environment.signer == nil {
+		signer, err := environment.newAuthenticator()
+		if err != nil {
+			return nil, err
+		}
+		environment.signer = signer
+	}
+
+	return environment.signer, nil
+}
+
+func (environment *Environment) newAuthenticator() (rsapi.Authenticator, error) {
+	switch environment.Auth.Mode {
+	case "", "refresh_token":
+		refreshToken, err := environment.getRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		return rsapi.NewOAuthAuthenticator(refreshToken, environment.Account), nil
+	case "password":
+		password, err := environment.authPassword()
+		if err != nil {
+			return nil, err
+		}
+		return rsapi.NewBasicAuthenticator(environment.Auth.Email, password, environment.Account), nil
+	case "access_token":
+		accessToken := environment.Auth.AccessToken
+		if accessToken == "" {
+			accessToken = strings.TrimSpace(os.Getenv(environment.Auth.AccessTokenEnv))
+			if accessToken == "" {
+				return nil, fmt.Errorf("Error reading access token: environment variable %s is not set", environment.Auth.AccessTokenEnv)
+			}
+		}
+		return rsapi.NewTokenAuthenticator(accessToken, environment.Account), nil
+	case "instance":
+		account, instanceToken, err := environment.instanceToken()
+		if err != nil {
+			return nil, err
+		}
+		return rsapi.NewInstanceAuthenticator(instanceToken, account), nil
+	default:
+		return nil, fmt.Errorf("Error authenticating: unsupported auth mode: %s", environment.Auth.Mode)
+	}
+}
+
+func (environment *Environment) authPassword() (string, error) {
+	if environment.Auth.Password == "" {
+		variable := environment.Auth.PasswordEnv
+		if variable == "" {
+			variable = authPasswordVariable
+		}
+		password, err := readPassphrase(variable, fmt.Sprintf("RightScale password for %s: ", environment.Auth.Email))
+		if err != nil {
+			return "", err
+		}
+		environment.Auth.Password = string(password)
+	}
+
+	return environment.Auth.Password, nil
+}
+
+func (environment *Environment) instanceToken() (int, string, error) {
+	instanceToken := environment.Auth.InstanceToken
+	if instanceToken == "" {
+		instanceToken = strings.TrimSpace(os.Getenv(authInstanceTokenVariable))
+		if instanceToken == "" {
+			return 0, "", fmt.Errorf("Error reading instance token: no instance_token and environment variable %s is not set (is RightLink running?)", authInstanceTokenVariable)
+		}
+	}
+
+	// RightLink sets RS_API_TOKEN to "<account>:<token>"
+	account := environment.Account
+	if index := strings.Index(instanceToken, ":"); index != -1 {
+		tokenAccount, err := strconv.Atoi(instanceToken[:index])
+		if err != nil {
+			return 0, "", fmt.Errorf("Error reading instance token: invalid account: %s", instanceToken[:index])
+		}
+		if account != 0 && account != tokenAccount {
+			return 0, "", fmt.Errorf("Error reading instance token: token is for account %d, not %d", tokenAccount, account)
+		}
+		account, instanceToken = tokenAccount, instanceToken[index+1:]
+	}
+
+	return account, instanceToken, nil
+}
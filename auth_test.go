@@ -0,0 +1,232 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/httpclient"
+	"gopkg.in/rightscale/rsc.v4/rsapi"
+)
+
+func TestEnvironmentCheckAuth(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(testingEnvironment.CheckAuth()).To(Succeed())
+	Expect((&Environment{}).CheckAuth()).To(MatchError("missing refresh_token, refresh_token_command, refresh_token_env or refresh_token_file"))
+	Expect((&Environment{Auth: AuthConfig{Mode: "password"}}).CheckAuth()).To(MatchError("auth: missing email for password mode"))
+	Expect((&Environment{Auth: AuthConfig{Mode: "password", Email: "alice@example.com"}}).CheckAuth()).To(Succeed())
+	Expect((&Environment{Auth: AuthConfig{Mode: "access_token"}}).CheckAuth()).To(MatchError("auth: missing access_token or access_token_env for access_token mode"))
+	Expect((&Environment{Auth: AuthConfig{Mode: "access_token", AccessTokenEnv: "RSRDP_TEST_ACCESS_TOKEN"}}).CheckAuth()).To(Succeed())
+	Expect((&Environment{Auth: AuthConfig{Mode: "instance"}}).CheckAuth()).To(Succeed())
+	Expect((&Environment{Auth: AuthConfig{Mode: "kerberos"}}).CheckAuth()).To(MatchError("auth: unsupported mode: kerberos"))
+}
+
+func TestEnvironmentAuthenticator(t *testing.T) {
+	RegisterTestingT(t)
+
+	environment := &Environment{Account: 54321, Host: "localhost", Auth: AuthConfig{Mode: "password", Email: "alice@example.com", Password: "secret"}}
+	client, err := environment.Client15()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(client).NotTo(BeNil())
+
+	os.Setenv(authPasswordVariable, "secret")
+	defer os.Unsetenv(authPasswordVariable)
+	environment = &Environment{Account: 54321, Host: "localhost", Auth: AuthConfig{Mode: "password", Email: "alice@example.com"}}
+	_, err = environment.authenticator()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(environment.Auth.Password).To(Equal("secret"))
+
+	environment = &Environment{Account: 54321, Host: "localhost", Auth: AuthConfig{Mode: "access_token", AccessTokenEnv: "RSRDP_TEST_ACCESS_TOKEN"}}
+	_, err = environment.Client16()
+	Expect(err).To(MatchError("Error reading access token: environment variable RSRDP_TEST_ACCESS_TOKEN is not set"))
+
+	os.Setenv("RSRDP_TEST_ACCESS_TOKEN", "abcdef\n")
+	defer os.Unsetenv("RSRDP_TEST_ACCESS_TOKEN")
+	_, err = environment.authenticator()
+	Expect(err).NotTo(HaveOccurred())
+
+	environment = &Environment{Account: 54321, Host: "localhost", Auth: AuthConfig{Mode: "kerberos"}}
+	_, err = environment.authenticator()
+	Expect(err).To(MatchError("Error authenticating: unsupported auth mode: kerberos"))
+}
+
+func TestEnvironmentAuthenticatorWithFakeEndpoint(t *testing.T) {
+	RegisterTestingT(t)
+
+	var logins []string
+	var authenticated string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/session"):
+			logins = append(logins, r.URL.Path)
+			if bytes.Contains(body, []byte("wrong")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "rs_gbl", Value: r.URL.Path})
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST" && r.URL.Path == "/api/oauth2":
+			logins = append(logins, r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"access_token":"oauth","expires_in":7200}`)
+		case r.URL.Path == "/api/accounts/54321":
+			authenticated = ""
+			if r.Header.Get("X-Account") != "54321" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if cookie, err := r.Cookie("rs_gbl"); err == nil {
+				authenticated = cookie.Value
+			} else if authorization := r.Header.Get("Authorization"); authorization == "Bearer abcdef" || authorization == "Bearer oauth" {
+				authenticated = authorization
+			} else {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	serverURL, _ := neturl.Parse(server.URL)
+
+	defer func(previous bool) { httpclient.Insecure = previous }(httpclient.Insecure)
+	httpclient.Insecure = true
+
+	get := func(api *rsapi.API) error {
+		request, err := api.BuildHTTPRequest("GET", "/api/accounts/54321", "1.5", nil, nil)
+		if err != nil {
+			return err
+		}
+		response, err := api.PerformRequest(request)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s", response.Status)
+		}
+		return nil
+	}
+	authenticate := func(environment *Environment) error {
+		auth, err := environment.authenticator()
+		if err != nil {
+			return err
+		}
+		return get(rsapi.New(environment.Host, auth))
+	}
+
+	environment := &Environment{Account: 54321, Host: serverURL.Host, Auth: AuthConfig{Mode: "password", Email: "alice@example.com", Password: "secret"}}
+	Expect(authenticate(environment)).To(Succeed())
+	Expect(authenticated).To(Equal("/api/session"))
+	client15, err := environment.Client15()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(get(client15.API)).To(Succeed())
+	client16, err := environment.Client16()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(get(client16.API)).To(Succeed())
+	Expect(logins).To(Equal([]string{"/api/session"}))
+
+	environment = &Environment{Account: 54321, Host: serverURL.Host, Auth: AuthConfig{Mode: "password", Email: "alice@example.com", Password: "wrong"}}
+	Expect(authenticate(environment)).To(HaveOccurred())
+
+	environment = &Environment{Account: 54321, Host: serverURL.Host, Auth: AuthConfig{Mode: "access_token", AccessToken: "abcdef"}}
+	Expect(authenticate(environment)).To(Succeed())
+	Expect(authenticated).To(Equal("Bearer abcdef"))
+
+	environment = &Environment{Account: 54321, Host: serverURL.Host, Auth: AuthConfig{Mode: "access_token", AccessToken: "wrong"}}
+	Expect(authenticate(environment)).To(MatchError("401 Unauthorized"))
+
+	logins = nil
+	environment = &Environment{Account: 54321, Host: serverURL.Host, RefreshToken: "refresh"}
+	Expect(authenticate(environment)).To(Succeed())
+	Expect(authenticated).To(Equal("Bearer oauth"))
+	Expect(logins).To(Equal([]string{"/api/oauth2"}))
+
+	os.Setenv(authInstanceTokenVariable, "54321:fedcba")
+	defer os.Unsetenv(authInstanceTokenVariable)
+	logins = nil
+	environment = &Environment{Account: 54321, Host: serverURL.Host, Auth: AuthConfig{Mode: "instance"}}
+	Expect(authenticate(environment)).To(Succeed())
+	Expect(authenticated).To(Equal("/api/session/instance"))
+	Expect(logins).To(Equal([]string{"/api/session/instance"}))
+}
+
+func TestEnvironmentInstanceToken(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Unsetenv(authInstanceTokenVariable)
+	environment := &Environment{Account: 54321, Host: "localhost", Auth: AuthConfig{Mode: "instance"}}
+	_, _, err := environment.instanceToken()
+	Expect(err).To(MatchError("Error reading instance token: no instance_token and environment variable RS_API_TOKEN is not set (is RightLink running?)"))
+
+	os.Setenv(authInstanceTokenVariable, "54321:abcdef")
+	defer os.Unsetenv(authInstanceTokenVariable)
+	account, token, err := environment.instanceToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(account).To(Equal(54321))
+	Expect(token).To(Equal("abcdef"))
+
+	environment.Account = 0
+	account, _, err = environment.instanceToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(account).To(Equal(54321))
+
+	environment.Account = 12345
+	_, _, err = environment.instanceToken()
+	Expect(err).To(MatchError("Error reading instance token: token is for account 54321, not 12345"))
+
+	os.Setenv(authInstanceTokenVariable, "abc:abcdef")
+	_, _, err = environment.instanceToken()
+	Expect(err).To(MatchError("Error reading instance token: invalid account: abc"))
+
+	environment.Auth.InstanceToken = "fedcba"
+	account, token, err = environment.instanceToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(account).To(Equal(12345))
+	Expect(token).To(Equal("fedcba"))
+}
+
+func TestIsSecretConfigKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(isSecretConfigKey("login.environments.production.refresh_token")).To(BeTrue())
+	Expect(isSecretConfigKey("login.environments.production.auth.password")).To(BeTrue())
+	Expect(isSecretConfigKey("login.environments.production.auth.access_token")).To(BeTrue())
+	Expect(isSecretConfigKey("login.environments.production.auth.instance_token")).To(BeTrue())
+	Expect(isSecretConfigKey("login.environments.production.auth.access_token_env")).To(BeFalse())
+	Expect(isSecretConfigKey("login.environments.production.password.provider")).To(BeFalse())
+	Expect(isSecretConfigKey("remmina.gateway.password")).To(BeFalse())
+}
@@ -0,0 +1,239 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	cacheSaltSize  = 16
+	cacheNonceSize = 24
+	cacheKeySize   = 32
+
+	cacheDefaultTTL = 24 * time.Hour
+)
+
+var cache *Cache
+
+type CacheEntry struct {
+	Password    string    `json:"password"`
+	ResourceUid string    `json:"resource_uid"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Expires     time.Time `json:"expires"`
+}
+
+type Cache struct {
+	mutex   sync.Mutex
+	file    string
+	key     *[cacheKeySize]byte
+	salt    []byte
+	ttl     time.Duration
+	entries map[string]*CacheEntry
+}
+
+func newCache(file string, ttl time.Duration, keyFunc func(salt []byte) (*[cacheKeySize]byte, error)) (*Cache, error) {
+	cache := &Cache{file: file, ttl: ttl, entries: make(map[string]*CacheEntry)}
+
+	content, err := ioutil.ReadFile(file)
+	switch {
+	case err == nil:
+		if len(content) < cacheSaltSize+cacheNonceSize {
+			return nil, fmt.Errorf("Error reading cache file: %s: file is truncated", file)
+		}
+		cache.salt = content[:cacheSaltSize]
+	case os.IsNotExist(err):
+		cache.salt = make([]byte, cacheSaltSize)
+		_, err = io.ReadFull(rand.Reader, cache.salt)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating cache salt: %s", err)
+		}
+	default:
+		return nil, fmt.Errorf("Error reading cache file: %s", err)
+	}
+
+	cache.key, err = keyFunc(cache.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if content != nil {
+		var nonce [cacheNonceSize]byte
+		copy(nonce[:], content[cacheSaltSize:cacheSaltSize+cacheNonceSize])
+		plaintext, ok := secretbox.Open(nil, content[cacheSaltSize+cacheNonceSize:], &nonce, cache.key)
+		if !ok {
+			return nil, fmt.Errorf("Error decrypting cache file: %s: wrong key or corrupt file", file)
+		}
+		err = json.Unmarshal(plaintext, &cache.entries)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding cache file: %s", err)
+		}
+	}
+
+	return cache, nil
+}
+
+func (cache *Cache) Get(href, resourceUid string, updatedAt time.Time) (string, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[href]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(entry.Expires) || entry.ResourceUid != resourceUid || !entry.UpdatedAt.Equal(updatedAt) {
+		delete(cache.entries, href)
+		return "", false
+	}
+
+	return entry.Password, true
+}
+
+func (cache *Cache) Put(href, resourceUid string, updatedAt time.Time, password string) error {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	now := time.Now()
+	for entryHref, entry := range cache.entries {
+		if now.After(entry.Expires) {
+			delete(cache.entries, entryHref)
+		}
+	}
+	cache.entries[href] = &CacheEntry{password, resourceUid, updatedAt, now.Add(cache.ttl)}
+
+	return cache.save()
+}
+
+func (cache *Cache) save() error {
+	plaintext, err := json.Marshal(cache.entries)
+	if err != nil {
+		return fmt.Errorf("Error encoding cache file: %s", err)
+	}
+
+	var nonce [cacheNonceSize]byte
+	_, err = io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return fmt.Errorf("Error generating cache nonce: %s", err)
+	}
+
+	content := bytes.NewBuffer(make([]byte, 0, cacheSaltSize+cacheNonceSize+len(plaintext)+secretbox.Overhead))
+	content.Write(cache.salt)
+	content.Write(nonce[:])
+	content.Write(secretbox.Seal(nil, plaintext, &nonce, cache.key))
+
+	err = os.MkdirAll(filepath.Dir(cache.file), 0700)
+	if err != nil {
+		return fmt.Errorf("Error creating cache directory: %s", err)
+	}
+
+	temporary := cache.file + ".tmp"
+	err = ioutil.WriteFile(temporary, content.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing cache file: %s", err)
+	}
+	err = os.Rename(temporary, cache.file)
+	if err != nil {
+		os.Remove(temporary)
+		return fmt.Errorf("Error writing cache file: %s", err)
+	}
+
+	return nil
+}
+
+func openCache() (*Cache, error) {
+	if !config.GetBool("cache.enabled") {
+		return nil, nil
+	}
+
+	file := config.GetString("cache.file")
+	if file == "" {
+		var err error
+		file, err = defaultCacheFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var keyFunc func(salt []byte) (*[cacheKeySize]byte, error)
+	switch source := config.GetString("cache.key"); source {
+	case "", "keyring":
+		keyFunc = cacheKeyringKey
+	case "passphrase":
+		keyFunc = cachePassphraseKey
+	default:
+		return nil, fmt.Errorf("Error opening cache: unsupported key source: %s", source)
+	}
+
+	ttl := cacheDefaultTTL
+	if config.IsSet("cache.ttl") {
+		ttl = config.GetDuration("cache.ttl")
+	}
+
+	return newCache(file, ttl, keyFunc)
+}
+
+func cacheKeyringKey(salt []byte) (*[cacheKeySize]byte, error) {
+	secret, err := keyringCacheKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) != cacheKeySize {
+		return nil, fmt.Errorf("Error retrieving cache key: key is %d bytes instead of %d", len(secret), cacheKeySize)
+	}
+
+	var key [cacheKeySize]byte
+	copy(key[:], secret)
+	return &key, nil
+}
+
+func cachePassphraseKey(salt []byte) (*[cacheKeySize]byte, error) {
+	passphrase, err := readPassphrase("RSRDP_CACHE_PASSPHRASE", "Cache passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	return cacheDeriveKey(passphrase, salt)
+}
+
+func cacheDeriveKey(passphrase, salt []byte) (*[cacheKeySize]byte, error) {
+	derived, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, cacheKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving cache key: %s", err)
+	}
+
+	var key [cacheKeySize]byte
+	copy(key[:], derived)
+	return &key, nil
+}
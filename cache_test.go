@@ -0,0 +1,137 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+func testCacheKey(passphrase string) func(salt []byte) (*[cacheKeySize]byte, error) {
+	return func(salt []byte) (*[cacheKeySize]byte, error) {
+		return cacheDeriveKey([]byte(passphrase), salt)
+	}
+}
+
+func TestCacheRoundTrip(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "cache")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rsrdp.cache")
+	updatedAt := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cache, err := newCache(file, time.Hour, testCacheKey("secret"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cache.Put("/api/clouds/1/instances/ABC", "uid", updatedAt, "p@ssw0rd")).To(Succeed())
+
+	content, err := ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).NotTo(ContainSubstring("p@ssw0rd"))
+
+	cache, err = newCache(file, time.Hour, testCacheKey("secret"))
+	Expect(err).NotTo(HaveOccurred())
+	password, ok := cache.Get("/api/clouds/1/instances/ABC", "uid", updatedAt)
+	Expect(ok).To(BeTrue())
+	Expect(password).To(Equal("p@ssw0rd"))
+
+	_, err = newCache(file, time.Hour, testCacheKey("wrong"))
+	Expect(err).To(MatchError(ContainSubstring("wrong key or corrupt file")))
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "cache")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rsrdp.cache")
+	updatedAt := time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	cache, err := newCache(file, time.Hour, testCacheKey("secret"))
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(cache.Put("/api/clouds/1/instances/ABC", "uid", updatedAt, "p@ssw0rd")).To(Succeed())
+	_, ok := cache.Get("/api/clouds/1/instances/ABC", "other", updatedAt)
+	Expect(ok).To(BeFalse())
+
+	Expect(cache.Put("/api/clouds/1/instances/ABC", "uid", updatedAt, "p@ssw0rd")).To(Succeed())
+	_, ok = cache.Get("/api/clouds/1/instances/ABC", "uid", updatedAt.Add(time.Minute))
+	Expect(ok).To(BeFalse())
+
+	_, ok = cache.Get("/api/clouds/1/instances/DEF", "uid", updatedAt)
+	Expect(ok).To(BeFalse())
+
+	cache.ttl = -time.Second
+	Expect(cache.Put("/api/clouds/1/instances/ABC", "uid", updatedAt, "p@ssw0rd")).To(Succeed())
+	_, ok = cache.Get("/api/clouds/1/instances/ABC", "uid", updatedAt)
+	Expect(ok).To(BeFalse())
+}
+
+func TestCacheInstanceLookups(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "cache")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	defer func(previous *Cache) { cache = previous }(cache)
+	cache, err = newCache(filepath.Join(dir, "rsrdp.cache"), time.Hour, testCacheKey("secret"))
+	Expect(err).NotTo(HaveOccurred())
+
+	resolver := &testingResolver{
+		instances: map[string]*cm15.Instance{
+			"/api/clouds/1/instances/ABC": {Links: []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/ABC"}}, ResourceUid: "abc", AdminPassword: "abc-password"},
+			"/api/clouds/1/instances/DEF": {Links: []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/DEF"}}, ResourceUid: "def", AdminPassword: "def-password"},
+		},
+		current: map[string][]string{"/api/server_arrays/1/current_instances": {"/api/clouds/1/instances/ABC", "/api/clouds/1/instances/DEF"}},
+		arrays: map[string]*cm15.ServerArray{
+			"/api/server_arrays/1": {Links: []map[string]string{{"rel": "current_instances", "href": "/api/server_arrays/1/current_instances"}}},
+		},
+	}
+	environment := testingEnvironment
+	environment.resolver = resolver
+
+	for attempt := 0; attempt < 2; attempt++ {
+		instances, err := urlGetInstancesFromServerArrayHref("/api/server_arrays/1", &environment, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instances).To(HaveLen(2))
+		Expect(instances[0].AdminPassword).To(Equal("abc-password"))
+		Expect(instances[1].AdminPassword).To(Equal("def-password"))
+
+		instance, err := urlGetInstanceFromInstanceHref("/api/clouds/1/instances/ABC", &environment, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(instance.AdminPassword).To(Equal("abc-password"))
+	}
+	Expect(resolver.sensitive).To(Equal(map[string]int{"/api/clouds/1/instances/ABC": 1, "/api/clouds/1/instances/DEF": 1}))
+
+	instances, err := urlGetInstancesFromServerArrayHref("/api/server_arrays/1", &environment, true)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(instances[0].AdminPassword).To(BeEmpty())
+}
@@ -24,31 +24,149 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/spf13/viper"
+	"gopkg.in/inconshreveable/log15.v2"
 )
 
 type Config struct {
 	*viper.Viper
 	environment  *Environment
 	environments map[string]*Environment
+	discovered   map[string]*Environment
+	origins      map[string]string
 }
 
-var config Config
+type ConfigMigration struct {
+	From string
+	To   string
+}
+
+const configEnvPrefix = "RSRDP"
+
+var (
+	config              Config
+	configSystemFile    = defaultSystemConfigFile()
+	configProjectLookup = true
+
+	// keys a project .rsrdp.yml may set; anything that runs commands, reads secrets or picks the hosts credentials
+	// are sent to stays with the user and system config files
+	configProjectKeys = []string{
+		"client.options",
+		"client.reconnect",
+		"remmina.save",
+		"remmina.resolution",
+		"remmina.color_depth",
+		"usernames",
+	}
+)
 
 func readConfig(configFile, environment string) error {
 	config.Viper = viper.New()
-	config.SetConfigFile(configFile)
-	err := config.ReadInConfig()
-	if err != nil {
-		return err
+	config.environments, config.environment = nil, nil
+	config.discovered = nil
+	config.origins = make(map[string]string)
+
+	layers := configLayers(configFile)
+	if len(layers) == 0 {
+		_, err := os.Stat(configFile)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s: is a directory", configFile)
 	}
 
-	err = config.UnmarshalKey("login.environments", &config.environments)
+	var problems []*ConfigError
+	for _, layer := range layers {
+		layerConfig := viper.New()
+		layerConfig.SetConfigFile(layer)
+		err := layerConfig.ReadInConfig()
+		if err != nil {
+			return fmt.Errorf("%s: %s", layer, err)
+		}
+
+		errs, err := validateConfigFile(layer)
+		if err != nil {
+			return err
+		}
+		problems = append(problems, errs...)
+
+		for _, key := range layerConfig.AllKeys() {
+			if isSecretConfigKey(key) && !isEncryptedSecret(layerConfig.GetString(key)) {
+				if info, err := os.Stat(layer); err == nil && fileWorldReadable(info) {
+					log15.Warn("config file with a plaintext secret is readable by other users, run chmod 600 on it or use refresh_token_command, refresh_token_env, refresh_token_file or config encrypt", "file", layer, "key", key)
+				}
+				break
+			}
+		}
+
+		settings := layerConfig.AllSettings()
+		project := layer != configSystemFile && layer != configFile
+		if project {
+			configFilterProjectSettings(layer, "", settings)
+		}
+		err = decryptSettings(settings, "")
+		if err != nil {
+			return fmt.Errorf("%s: %s", layer, err)
+		}
+
+		err = config.MergeConfigMap(settings)
+		if err != nil {
+			return fmt.Errorf("%s: %s", layer, err)
+		}
+		for _, key := range layerConfig.AllKeys() {
+			if !project || configProjectKeyAllowed(key) {
+				config.origins[key] = layer
+			}
+		}
+	}
+
+	config.SetEnvPrefix(configEnvPrefix)
+	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	for _, key := range configSchema.Leaves("") {
+		config.BindEnv(key)
+		if variable := configEnvVariable(key); os.Getenv(variable) != "" {
+			config.origins[key] = "$" + variable
+		}
+	}
+
+	for _, problem := range problems {
+		switch {
+		case problem.Unknown:
+			log15.Warn("ignoring unknown config key", "file", problem.File, "line", problem.Line, "key", problem.Path)
+		case problem.Missing && config.IsSet(problem.Path):
+			// another layer provides the key
+		default:
+			return problem
+		}
+	}
+
+	err := config.UnmarshalKey("login.environments", &config.environments)
 	if err != nil {
 		return fmt.Errorf("%s: %s", configFile, err)
 	}
 
+	names := make([]string, 0, len(config.environments))
+	for name := range config.environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		err = config.environments[name].setAccounts(config.Get("login.environments." + name + ".accounts"))
+		if err != nil {
+			return fmt.Errorf("%s: login.environments.%s: %s", configFile, name, err)
+		}
+		config.environments[name].Host = normalizeHost(config.environments[name].Host)
+		err = config.environments[name].CheckAuth()
+		if err != nil {
+			return fmt.Errorf("%s: login.environments.%s: %s", configFile, name, err)
+		}
+	}
+
 	var ok bool
 	if environment == "" {
 		defaultEnvironment := config.GetString("login.default_environment")
@@ -66,12 +184,237 @@ func readConfig(configFile, environment string) error {
 	return nil
 }
 
+func configLayers(configFile string) []string {
+	candidates := []string{configSystemFile, configFile}
+	if directory, err := os.Getwd(); err == nil && configProjectLookup {
+		candidates = append(candidates, findProjectConfigFile(directory))
+	}
+
+	layers := make([]string, 0, len(candidates))
+	seen := make(map[string]bool)
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		absolute, err := filepath.Abs(candidate)
+		if err != nil || seen[absolute] {
+			continue
+		}
+		seen[absolute] = true
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			layers = append(layers, candidate)
+		}
+	}
+
+	return layers
+}
+
+func configFilterProjectSettings(file, prefix string, settings map[string]interface{}) {
+	for key, value := range settings {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if configProjectKeyAllowed(path) {
+			continue
+		}
+
+		if child, ok := value.(map[string]interface{}); ok && configProjectKeyParent(path) {
+			configFilterProjectSettings(file, path, child)
+			if len(child) == 0 {
+				delete(settings, key)
+			}
+			continue
+		}
+
+		log15.Warn("ignoring config key that is not allowed in a project config file", "file", file, "key", path)
+		delete(settings, key)
+	}
+}
+
+func configProjectKeyAllowed(key string) bool {
+	for _, allowed := range configProjectKeys {
+		if key == allowed || strings.HasPrefix(key, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func configProjectKeyParent(key string) bool {
+	for _, allowed := range configProjectKeys {
+		if strings.HasPrefix(allowed, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func findProjectConfigFile(directory string) string {
+	// stop before the home directory, where .rsrdp.yml is the legacy user config file
+	home, err := homeDir()
+	if err == nil {
+		home, err = filepath.Abs(home)
+	}
+	if err != nil {
+		home = ""
+	}
+
+	for {
+		if directory == home {
+			return ""
+		}
+
+		file := filepath.Join(directory, ".rsrdp.yml")
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			return file
+		}
+
+		parent := filepath.Dir(directory)
+		if parent == directory {
+			return ""
+		}
+		directory = parent
+	}
+}
+
+func configEnvVariable(key string) string {
+	return configEnvPrefix + "_" + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+func (config *Config) Origin(key string) string {
+	for prefix := key; prefix != ""; {
+		if origin, ok := config.origins[prefix]; ok {
+			return origin
+		}
+		index := strings.LastIndex(prefix, ".")
+		if index == -1 {
+			break
+		}
+		prefix = prefix[:index]
+	}
+	return "default"
+}
+
 func (config *Config) getEnvironment(account int, host string) (*Environment, error) {
-	for _, environment := range config.environments {
-		if environment.Account == account && environment.Host == host {
+	host = normalizeHost(host)
+	names := config.environmentNames()
+	for _, name := range names {
+		environment := config.environments[name]
+		if environment.Account == account && normalizeHost(environment.Host) == host {
 			return environment, nil
 		}
 	}
+	for _, name := range names {
+		environment := config.environments[name]
+		if environment.Account == account && environment.hasHostAlias(host) {
+			return environment, nil
+		}
+	}
+
+	environment, err := config.discoverEnvironment(account, host)
+	if err != nil {
+		return nil, fmt.Errorf("Error finding environment for account/host: %d %s: %s", account, host, err)
+	}
+	if environment == nil {
+		return nil, fmt.Errorf("Error finding environment for account/host: %d %s", account, host)
+	}
+
+	return environment, nil
+}
+
+func configCheck(configFile string) error {
+	layers := configLayers(configFile)
+	if len(layers) == 0 {
+		return fmt.Errorf("Error checking config file: %s: no config files found", configFile)
+	}
+
+	problems := 0
+	for _, layer := range layers {
+		errs, err := validateConfigFile(layer)
+		if err != nil {
+			return fmt.Errorf("Error checking config file: %s", err)
+		}
+		for _, err := range errs {
+			if err.Missing && len(layers) > 1 {
+				continue
+			}
+			// unknown keys are ignored when reading the config, so they are not problems here either
+			if err.Unknown {
+				fmt.Printf("%s (ignored)\n", err)
+				continue
+			}
+			fmt.Println(err)
+			problems++
+		}
+	}
+	if problems != 0 {
+		return fmt.Errorf("Error checking config file: %d problems found", problems)
+	}
+
+	err := readConfig(configFile, "")
+	if err != nil {
+		return fmt.Errorf("Error checking config file: %s", err)
+	}
+
+	for _, layer := range layers {
+		fmt.Printf("%s: ok\n", layer)
+	}
+	return nil
+}
 
-	return nil, fmt.Errorf("Error finding environment for account/host: %d %s", account, host)
+func configShow(origin bool) error {
+	keys := config.AllKeys()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value := config.Get(key)
+		if value == nil {
+			continue
+		}
+		if isSecretConfigKey(key) {
+			value = "********"
+		}
+		if origin {
+			fmt.Printf("%s = %v (%s)\n", key, value, config.Origin(key))
+		} else {
+			fmt.Printf("%s = %v\n", key, value)
+		}
+	}
+
+	return nil
+}
+
+func configMigrate() error {
+	migrations, err := configMigrations()
+	if err != nil {
+		return err
+	}
+
+	migrated := 0
+	for _, migration := range migrations {
+		if _, err := os.Stat(migration.From); os.IsNotExist(err) {
+			continue
+		}
+		if _, err := os.Stat(migration.To); err == nil {
+			return fmt.Errorf("Error migrating %s: %s already exists", migration.From, migration.To)
+		}
+
+		err = os.MkdirAll(filepath.Dir(migration.To), 0700)
+		if err != nil {
+			return fmt.Errorf("Error migrating %s: %s", migration.From, err)
+		}
+		err = os.Rename(migration.From, migration.To)
+		if err != nil {
+			return fmt.Errorf("Error migrating %s: %s", migration.From, err)
+		}
+
+		fmt.Printf("Moved %s to %s\n", migration.From, migration.To)
+		migrated++
+	}
+
+	if migrated == 0 {
+		fmt.Println("Nothing to migrate")
+	}
+	return nil
 }
@@ -0,0 +1,263 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ConfigDocument struct {
+	file string
+	root yaml.Node
+}
+
+func loadConfigDocument(file string) (*ConfigDocument, error) {
+	document := &ConfigDocument{file: file}
+
+	content, err := ioutil.ReadFile(file)
+	switch {
+	case err == nil:
+		err = yaml.Unmarshal(content, &document.root)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing config file: %s: %s", file, err)
+		}
+	case !os.IsNotExist(err):
+		return nil, fmt.Errorf("Error reading config file: %s", err)
+	}
+
+	if document.root.Kind == 0 {
+		document.root = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if document.root.Kind != yaml.DocumentNode || len(document.root.Content) != 1 || document.root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("Error parsing config file: %s: top level is not a mapping", file)
+	}
+
+	return document, nil
+}
+
+func (document *ConfigDocument) Save() error {
+	var content bytes.Buffer
+	encoder := yaml.NewEncoder(&content)
+	encoder.SetIndent(2)
+	err := encoder.Encode(&document.root)
+	if err != nil {
+		return fmt.Errorf("Error encoding config file: %s", err)
+	}
+	err = encoder.Close()
+	if err != nil {
+		return fmt.Errorf("Error encoding config file: %s", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(document.file), 0700)
+	if err != nil {
+		return fmt.Errorf("Error creating config directory: %s", err)
+	}
+
+	// replace the file a symlink points at rather than the symlink itself
+	file := document.file
+	if target, err := filepath.EvalSymlinks(file); err == nil {
+		file = target
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("Error writing config file: %s", err)
+	}
+
+	temporary := file + ".tmp"
+	err = ioutil.WriteFile(temporary, content.Bytes(), 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing config file: %s", err)
+	}
+	err = os.Rename(temporary, file)
+	if err != nil {
+		os.Remove(temporary)
+		return fmt.Errorf("Error writing config file: %s", err)
+	}
+
+	return nil
+}
+
+func (document *ConfigDocument) EnvironmentNames() []string {
+	environments := configDocumentLookup(document.root.Content[0], "login", "environments")
+	if environments == nil || environments.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	names := make([]string, 0, len(environments.Content)/2)
+	for index := 0; index < len(environments.Content); index += 2 {
+		names = append(names, environments.Content[index].Value)
+	}
+	return names
+}
+
+func (document *ConfigDocument) SetEnvironment(name string, environment *Environment) {
+	login := configDocumentMapping(document.root.Content[0], "login")
+	environments := configDocumentMapping(login, "environments")
+	entry := configDocumentMapping(environments, name)
+	configDocumentSet(entry, "account", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(environment.Account)})
+	configDocumentSet(entry, "host", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: environment.Host})
+	configDocumentSet(entry, "refresh_token", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: environment.RefreshToken})
+
+	// other ways of authenticating would take precedence over or conflict with the new refresh token
+	for _, key := range []string{"refresh_token_command", "refresh_token_env", "refresh_token_file", "auth"} {
+		configDocumentDelete(entry, key)
+	}
+}
+
+func (document *ConfigDocument) AddEnvironment(name string, environment *Environment, makeDefault bool) error {
+	document.SetEnvironment(name, environment)
+	if makeDefault || document.DefaultEnvironment() == "" {
+		return document.SetDefaultEnvironment(name)
+	}
+	return nil
+}
+
+func (document *ConfigDocument) RemoveEnvironment(name string) error {
+	environments := configDocumentLookup(document.root.Content[0], "login", "environments")
+	if environments == nil || !configDocumentDelete(environments, name) {
+		return fmt.Errorf("%s: could not find environment: %s", document.file, name)
+	}
+	if name == document.DefaultEnvironment() {
+		login := configDocumentLookup(document.root.Content[0], "login")
+		configDocumentDelete(login, "default_environment")
+	}
+	return nil
+}
+
+func (document *ConfigDocument) DefaultEnvironment() string {
+	defaultEnvironment := configDocumentLookup(document.root.Content[0], "login", "default_environment")
+	if defaultEnvironment == nil {
+		return ""
+	}
+	return defaultEnvironment.Value
+}
+
+func (document *ConfigDocument) SetDefaultEnvironment(name string) error {
+	if configDocumentLookup(document.root.Content[0], "login", "environments", name) == nil {
+		return fmt.Errorf("%s: could not find environment: %s", document.file, name)
+	}
+
+	login := configDocumentMapping(document.root.Content[0], "login")
+	configDocumentSet(login, "default_environment", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name})
+	return nil
+}
+
+func (document *ConfigDocument) WalkScalars(replace func(path, value string) (string, error)) error {
+	return configDocumentWalk(document.root.Content[0], "", replace)
+}
+
+func (document *ConfigDocument) EncryptedValue() (string, string) {
+	var encryptedPath, encryptedValue string
+	configDocumentWalk(document.root.Content[0], "", func(path, value string) (string, error) {
+		if encryptedPath == "" && isEncryptedSecret(value) {
+			encryptedPath, encryptedValue = path, value
+		}
+		return value, nil
+	})
+	return encryptedPath, encryptedValue
+}
+
+func configDocumentWalk(node *yaml.Node, path string, replace func(path, value string) (string, error)) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			err := configDocumentWalk(node.Content[index+1], configJoinPath(path, node.Content[index].Value), replace)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for index, item := range node.Content {
+			err := configDocumentWalk(item, fmt.Sprintf("%s[%d]", path, index), replace)
+			if err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			return nil
+		}
+		value, err := replace(path, node.Value)
+		if err != nil {
+			return err
+		}
+		if value != node.Value {
+			node.Value = value
+			node.Style = 0
+		}
+	}
+	return nil
+}
+
+func configDocumentLookup(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var value *yaml.Node
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			if node.Content[index].Value == key {
+				value = node.Content[index+1]
+				break
+			}
+		}
+		node = value
+	}
+	return node
+}
+
+func configDocumentMapping(node *yaml.Node, key string) *yaml.Node {
+	value := configDocumentLookup(node, key)
+	if value == nil || value.Kind != yaml.MappingNode {
+		value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		configDocumentSet(node, key, value)
+	}
+	return value
+}
+
+func configDocumentSet(node *yaml.Node, key string, value *yaml.Node) {
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		if node.Content[index].Value == key {
+			value.HeadComment = node.Content[index+1].HeadComment
+			value.LineComment = node.Content[index+1].LineComment
+			node.Content[index+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+func configDocumentDelete(node *yaml.Node, key string) bool {
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		if node.Content[index].Value == key {
+			node.Content = append(node.Content[:index], node.Content[index+2:]...)
+			return true
+		}
+	}
+	return false
+}
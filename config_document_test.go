@@ -0,0 +1,233 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testingConfigDocument = `# RSRDP configuration
+login:
+  default_environment: production
+  environments:
+    # the main account
+    production:
+      account: 12345
+      host: us-3.rightscale.com # shard 3
+      refresh_token: abcdef1234567890abcdef1234567890abcdef12
+    staging:
+      account: 67890
+      host: us-4.rightscale.com
+      refresh_token: fedcba0987654321febcba0987654321fedcba09
+client:
+  executable: rdesktop
+`
+
+func TestConfigDocumentKeepsComments(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(file, []byte(testingConfigDocument), 0600)).To(Succeed())
+
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.EnvironmentNames()).To(Equal([]string{"production", "staging"}))
+	Expect(document.DefaultEnvironment()).To(Equal("production"))
+
+	document.SetEnvironment("production", &Environment{Account: 12345, Host: "us-4.rightscale.com", RefreshToken: "0123456789abcdef0123456789abcdef01234567"})
+	Expect(document.Save()).To(Succeed())
+
+	content, err := ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(ContainSubstring("# RSRDP configuration"))
+	Expect(string(content)).To(ContainSubstring("# the main account"))
+	Expect(string(content)).To(ContainSubstring("host: us-4.rightscale.com # shard 3"))
+	Expect(string(content)).To(ContainSubstring("executable: rdesktop"))
+}
+
+func TestConfigDocumentSetEnvironmentClearsAuth(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(file, []byte(`login:
+  default_environment: production
+  environments:
+    production:
+      account: 12345
+      host: us-3.rightscale.com
+      host_aliases: [rightscale.example.com]
+      refresh_token_command: [pass, rightscale]
+      refresh_token_env: RS_REFRESH_TOKEN
+      refresh_token_file: /home/alice/.rightscale
+      auth:
+        mode: password
+        email: alice@example.com
+`), 0600)).To(Succeed())
+
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	document.SetEnvironment("production", &Environment{Account: 12345, Host: "us-3.rightscale.com", RefreshToken: testingEnvironment.RefreshToken})
+	Expect(document.Save()).To(Succeed())
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environment).To(Equal(&Environment{
+		Account:      12345,
+		Host:         "us-3.rightscale.com",
+		HostAliases:  []string{"rightscale.example.com"},
+		RefreshToken: testingEnvironment.RefreshToken,
+	}))
+}
+
+func TestConfigDocumentSaveWithSymlink(t *testing.T) {
+	RegisterTestingT(t)
+
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks needs extra privileges on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "dotfiles", "rsrdp.yml")
+	Expect(os.Mkdir(filepath.Dir(target), 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(target, []byte(testingConfigDocument), 0600)).To(Succeed())
+	file := filepath.Join(dir, ".rsrdp.yml")
+	Expect(os.Symlink(target, file)).To(Succeed())
+
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.SetDefaultEnvironment("staging")).To(Succeed())
+	Expect(document.Save()).To(Succeed())
+
+	info, err := os.Lstat(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(info.Mode() & os.ModeSymlink).NotTo(BeZero())
+	content, err := ioutil.ReadFile(target)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(ContainSubstring("default_environment: staging"))
+}
+
+func TestEnvRemoveAndSetDefault(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(file, []byte(testingConfigDocument), 0600)).To(Succeed())
+
+	err = envRemove(file, "production")
+	Expect(err).To(MatchError("Error removing environment: production: environment is the default environment (set another default first)"))
+
+	err = envRemove(file, "development")
+	Expect(err).To(MatchError(file + ": could not find environment: development"))
+
+	err = envSetDefault(file, "development")
+	Expect(err).To(MatchError(file + ": could not find environment: development"))
+
+	Expect(envSetDefault(file, "staging")).To(Succeed())
+	Expect(envRemove(file, "production")).To(Succeed())
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environments).To(HaveLen(1))
+	Expect(config.environment.Account).To(Equal(67890))
+}
+
+func TestConfigDocumentAddEnvironmentWithNewFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "RSRDP", ".rsrdp.yml")
+
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.AddEnvironment("production", &testingEnvironment, false)).To(Succeed())
+	Expect(document.Save()).To(Succeed())
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	}
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environment).To(Equal(&Environment{
+		Account:      testingEnvironment.Account,
+		Host:         testingEnvironment.Host,
+		RefreshToken: testingEnvironment.RefreshToken,
+	}))
+}
+
+func TestConfigDocumentAddEnvironmentWithExample(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	content, err := ioutil.ReadFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(file, content, 0600)).To(Succeed())
+
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.AddEnvironment("development", &testingEnvironment, false)).To(Succeed())
+	Expect(document.Save()).To(Succeed())
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environments).To(HaveLen(3))
+	Expect(config.environments).To(HaveKey("development"))
+	Expect(config.environment.Account).To(Equal(12345))
+	Expect(config.GetString("remmina.gateway.server")).To(Equal("gateway.example.com"))
+
+	environment := &Environment{Account: 67890, Host: "us-4.rightscale.com", RefreshToken: "0123456789abcdef0123456789abcdef01234567"}
+	document, err = loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.AddEnvironment("staging", environment, true)).To(Succeed())
+	Expect(document.Save()).To(Succeed())
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environment.RefreshToken).To(Equal("0123456789abcdef0123456789abcdef01234567"))
+	content, err = ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(ContainSubstring("# refresh_token_env: RSRDP_STAGING_REFRESH_TOKEN"))
+}
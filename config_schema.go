@@ -0,0 +1,368 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+type ConfigSchema struct {
+	Type     string
+	Keys     map[string]*ConfigSchema
+	Values   *ConfigSchema
+	Required bool
+	Check    func(value string) error
+}
+
+type ConfigError struct {
+	File    string
+	Line    int
+	Path    string
+	Message string
+	Unknown bool
+	Missing bool
+}
+
+var (
+	configHost       = regexp.MustCompile("^[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?(\\.[A-Za-z0-9]([A-Za-z0-9-]*[A-Za-z0-9])?)*(:\\d+)?$")
+	configResolution = regexp.MustCompile("^\\d+x\\d+$")
+)
+
+var configSchema = &ConfigSchema{Type: "mapping", Keys: map[string]*ConfigSchema{
+	"login": {Type: "mapping", Required: true, Keys: map[string]*ConfigSchema{
+		"default_environment": {Type: "string", Required: true},
+		"environments": {Type: "mapping", Required: true, Values: &ConfigSchema{Type: "mapping", Keys: map[string]*ConfigSchema{
+			"account":               {Type: "int", Required: true, Check: configCheckAccount},
+			"host":                  {Type: "string", Required: true, Check: configCheckHost},
+			"host_aliases":          {Type: "sequence", Values: &ConfigSchema{Type: "string", Check: configCheckHost}},
+			"accounts":              {Type: "accounts"},
+			"refresh_token":         {Type: "string"},
+			"refresh_token_command": {Type: "sequence", Values: &ConfigSchema{Type: "string"}},
+			"refresh_token_env":     {Type: "string"},
+			"refresh_token_file":    {Type: "string"},
+			"auth": {Type: "mapping", Keys: map[string]*ConfigSchema{
+				"mode":             {Type: "string", Check: configCheckEnum("refresh_token", "password", "access_token", "instance")},
+				"email":            {Type: "string"},
+				"password":         {Type: "string"},
+				"password_env":     {Type: "string"},
+				"access_token":     {Type: "string"},
+				"access_token_env": {Type: "string"},
+				"instance_token":   {Type: "string"},
+			}},
+			"password": {Type: "mapping", Keys: map[string]*ConfigSchema{
+				"provider":   {Type: "string", Check: configCheckEnum("rightscale", "credential", "input", "command", "environment")},
+				"credential": {Type: "string"},
+				"input":      {Type: "string"},
+				"command":    {Type: "sequence", Values: &ConfigSchema{Type: "string"}},
+				"variable":   {Type: "string"},
+			}},
+		}}},
+	}},
+	"client": {Type: "mapping", Keys: map[string]*ConfigSchema{
+		"executable":  {Type: "string"},
+		"options":     {Type: "sequence", Values: &ConfigSchema{Type: "string"}},
+		"shred":       {Type: "bool"},
+		"shred_delay": {Type: "duration"},
+		"keyring":     {Type: "bool"},
+		"reconnect": {Type: "mapping", Keys: map[string]*ConfigSchema{
+			"attempts": {Type: "int"},
+			"backoff":  {Type: "duration"},
+		}},
+	}},
+	"remmina": {Type: "mapping", Keys: map[string]*ConfigSchema{
+		"save":         {Type: "bool"},
+		"resolution":   {Type: "string", Check: configCheckResolution},
+		"color_depth":  {Type: "int"},
+		"share_folder": {Type: "string"},
+		"gateway": {Type: "mapping", Keys: map[string]*ConfigSchema{
+			"server":   {Type: "string"},
+			"username": {Type: "string"},
+			"domain":   {Type: "string"},
+		}},
+	}},
+	"cache": {Type: "mapping", Keys: map[string]*ConfigSchema{
+		"enabled": {Type: "bool"},
+		"ttl":     {Type: "duration"},
+		"key":     {Type: "string", Check: configCheckEnum("keyring", "passphrase")},
+		"file":    {Type: "string"},
+	}},
+	"usernames": {Type: "sequence", Values: &ConfigSchema{Type: "mapping", Keys: map[string]*ConfigSchema{
+		"environment": {Type: "string"},
+		"deployment":  {Type: "string"},
+		"server":      {Type: "string"},
+		"tag":         {Type: "string"},
+		"username":    {Type: "string"},
+		"domain":      {Type: "string"},
+	}}},
+}}
+
+func (err *ConfigError) Error() string {
+	location := err.File
+	if err.Line != 0 {
+		location = fmt.Sprintf("%s:%d", err.File, err.Line)
+	}
+	if err.Path == "" {
+		return fmt.Sprintf("%s: %s", location, err.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, err.Path, err.Message)
+}
+
+func validateConfigFile(file string) ([]*ConfigError, error) {
+	var content []byte
+	var err error
+	extension := strings.ToLower(filepath.Ext(file))
+	yamlFile := extension == ".yml" || extension == ".yaml"
+	if yamlFile {
+		content, err = ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// other formats have no line numbers, so validate what viper reads from them
+		fileConfig := viper.New()
+		fileConfig.SetConfigFile(file)
+		err = fileConfig.ReadInConfig()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		content, err = yaml.Marshal(fileConfig.AllSettings())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+	}
+
+	var root yaml.Node
+	err = yaml.Unmarshal(content, &root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+
+	var errs []*ConfigError
+	if root.Kind == 0 {
+		return append(errs, &ConfigError{File: file, Line: 1, Message: "file is empty"}), nil
+	}
+	configSchema.validate(file, "", root.Content[0], &errs)
+	if !yamlFile {
+		for _, err := range errs {
+			err.Line = 0
+		}
+	}
+
+	return errs, nil
+}
+
+func (schema *ConfigSchema) validate(file, path string, node *yaml.Node, errs *[]*ConfigError) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, &ConfigError{File: file, Line: node.Line, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch schema.Type {
+	case "mapping":
+		if node.Kind != yaml.MappingNode {
+			fail("expected a mapping, found %s", configDescribeNode(node))
+			return
+		}
+
+		present := make(map[string]bool)
+		for index := 0; index+1 < len(node.Content); index += 2 {
+			key, value := node.Content[index], node.Content[index+1]
+			present[key.Value] = true
+			childPath := configJoinPath(path, key.Value)
+
+			child := schema.Values
+			if schema.Keys != nil {
+				child = schema.Keys[key.Value]
+			}
+			if child == nil {
+				*errs = append(*errs, &ConfigError{File: file, Line: key.Line, Path: childPath, Message: "unknown key", Unknown: true})
+				continue
+			}
+			child.validate(file, childPath, value, errs)
+		}
+
+		keys := make([]string, 0, len(schema.Keys))
+		for key := range schema.Keys {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if schema.Keys[key].Required && !present[key] {
+				*errs = append(*errs, &ConfigError{File: file, Line: node.Line, Path: configJoinPath(path, key), Message: "missing required key", Missing: true})
+			}
+		}
+		return
+	case "sequence":
+		if node.Kind != yaml.SequenceNode {
+			fail("expected a list, found %s", configDescribeNode(node))
+			return
+		}
+		for index, item := range node.Content {
+			schema.Values.validate(file, fmt.Sprintf("%s[%d]", path, index), item, errs)
+		}
+		return
+	case "accounts":
+		if node.Kind == yaml.SequenceNode {
+			for index, item := range node.Content {
+				(&ConfigSchema{Type: "int", Check: configCheckAccount}).validate(file, fmt.Sprintf("%s[%d]", path, index), item, errs)
+			}
+		} else if node.Kind != yaml.ScalarNode || node.Value != "all" {
+			fail("expected all or a list of accounts, found %s", configDescribeNode(node))
+		}
+		return
+	}
+
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		fail("expected %s, found %s", configDescribeType(schema.Type), configDescribeNode(node))
+		return
+	}
+
+	switch schema.Type {
+	case "int":
+		if node.Tag != "!!int" {
+			fail("expected an integer, found %q", node.Value)
+			return
+		}
+	case "bool":
+		if node.Tag != "!!bool" {
+			fail("expected true or false, found %q", node.Value)
+			return
+		}
+	case "duration":
+		_, err := time.ParseDuration(node.Value)
+		if err != nil {
+			fail("expected a duration (e.g. 30s or 5m), found %q", node.Value)
+			return
+		}
+	}
+
+	if schema.Check != nil {
+		err := schema.Check(node.Value)
+		if err != nil {
+			fail("%s", err)
+		}
+	}
+}
+
+func (schema *ConfigSchema) Leaves(path string) []string {
+	switch {
+	case schema.Type == "mapping" && schema.Keys == nil:
+		return nil
+	case schema.Type == "sequence" && schema.Values.Type == "mapping":
+		return nil
+	case schema.Type != "mapping":
+		return []string{path}
+	}
+
+	keys := make([]string, 0, len(schema.Keys))
+	for key := range schema.Keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var leaves []string
+	for _, key := range keys {
+		leaves = append(leaves, schema.Keys[key].Leaves(configJoinPath(path, key))...)
+	}
+	return leaves
+}
+
+func configJoinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func configDescribeType(schemaType string) string {
+	switch schemaType {
+	case "int":
+		return "an integer"
+	case "bool":
+		return "true or false"
+	case "duration":
+		return "a duration"
+	default:
+		return "a " + schemaType
+	}
+}
+
+func configDescribeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		if node.Tag == "!!null" {
+			return "nothing"
+		}
+		return strconv.Quote(node.Value)
+	}
+}
+
+func configCheckAccount(value string) error {
+	account, err := strconv.Atoi(value)
+	if err != nil || account <= 0 {
+		return fmt.Errorf("expected a positive integer, found %s", value)
+	}
+	return nil
+}
+
+func configCheckHost(value string) error {
+	if !configHost.MatchString(value) {
+		return fmt.Errorf("expected a host name like us-3.rightscale.com, found %q", value)
+	}
+	return nil
+}
+
+func configCheckResolution(value string) error {
+	if !configResolution.MatchString(value) {
+		return fmt.Errorf("expected a resolution like 1280x800, found %q", value)
+	}
+	return nil
+}
+
+func configCheckEnum(values ...string) func(value string) error {
+	return func(value string) error {
+		for _, allowed := range values {
+			if value == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected one of %s, found %q", strings.Join(values, ", "), value)
+	}
+}
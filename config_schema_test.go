@@ -0,0 +1,121 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+var invalidConfigFile = "test/invalid.rsrdp.yml"
+
+func configErrorStrings(errs []*ConfigError) []string {
+	strings := make([]string, len(errs))
+	for index, err := range errs {
+		strings[index] = err.Error()
+	}
+	return strings
+}
+
+func TestValidateConfigFileWithExample(t *testing.T) {
+	RegisterTestingT(t)
+
+	errs, err := validateConfigFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(errs).To(BeEmpty())
+}
+
+func TestValidateConfigFileWithBadEnvironment(t *testing.T) {
+	RegisterTestingT(t)
+
+	errs, err := validateConfigFile(badEnvironmentConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configErrorStrings(errs)).To(Equal([]string{
+		badEnvironmentConfigFile + ":4: login.environments: expected a mapping, found a list",
+	}))
+}
+
+func TestValidateConfigFileWithInvalid(t *testing.T) {
+	RegisterTestingT(t)
+
+	errs, err := validateConfigFile(invalidConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configErrorStrings(errs)).To(Equal([]string{
+		invalidConfigFile + ":5: login.environments.production.account: expected a positive integer, found 0",
+		invalidConfigFile + ":6: login.environments.production.host: expected a host name like us-3.rightscale.com, found \"https://us-3.rightscale.com/\"",
+		invalidConfigFile + ":9: login.environments.staging.account: expected an integer, found \"67890\"",
+		invalidConfigFile + ":9: login.environments.staging.host: missing required key",
+		invalidConfigFile + ":12: client.options: expected a list, found \"-f\"",
+		invalidConfigFile + ":13: client.shred: expected true or false, found \"yes please\"",
+		invalidConfigFile + ":15: client.reconnect.backoff: expected a duration (e.g. 30s or 5m), found \"10\"",
+		invalidConfigFile + ":17: remmina.resolution: expected a resolution like 1280x800, found \"large\"",
+		invalidConfigFile + ":19: cache.key: expected one of keyring, passphrase, found \"password\"",
+		invalidConfigFile + ":20: colour: unknown key",
+	}))
+	Expect(errs[len(errs)-1].Unknown).To(BeTrue())
+}
+
+func TestValidateConfigFileWithJSON(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.json")
+	Expect(ioutil.WriteFile(file, []byte(`{
+  "login": {
+    "default_environment": "production",
+    "environments": {"production": {"account": 0, "host": "us-3.rightscale.com", "refresh_token": "abcdef"}}
+  },
+  "colour": "blue"
+}`), 0600)).To(Succeed())
+
+	errs, err := validateConfigFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configErrorStrings(errs)).To(Equal([]string{
+		file + ": colour: unknown key",
+		file + ": login.environments.production.account: expected a positive integer, found 0",
+	}))
+}
+
+func TestConfigCheckWithUnknownKey(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	content, err := ioutil.ReadFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(file, append(content, "colour: blue\n"...), 0600)).To(Succeed())
+
+	Expect(configCheck(file)).To(Succeed())
+	Expect(readConfig(file, "")).To(Succeed())
+
+	Expect(ioutil.WriteFile(file, append(content, "client:\n  shred: yes please\n"...), 0600)).To(Succeed())
+	Expect(configCheck(file)).To(MatchError("Error checking config file: 1 problems found"))
+}
@@ -23,7 +23,10 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -36,11 +39,18 @@ var (
 	exampleConfigFile                   = "example/.rsrdp.yml"
 )
 
+func TestMain(m *testing.M) {
+	// keep the machine's system config and the checkout's parent directories out of the tests
+	configSystemFile = ""
+	configProjectLookup = false
+	os.Exit(m.Run())
+}
+
 func TestDefaultConfigFile(t *testing.T) {
 	RegisterTestingT(t)
 
-	configFile := defaultConfigFile()
-	Expect(filepath.Base(configFile)).To(Equal(".rsrdp.yml"))
+	configFile, err := defaultConfigFile()
+	Expect(err).NotTo(HaveOccurred())
 	Expect(filepath.IsAbs(configFile)).To(BeTrue())
 }
 
@@ -51,11 +61,22 @@ func TestReadConfigWithNonexistentFile(t *testing.T) {
 	Expect(err).To(HaveOccurred())
 }
 
+func TestReadConfigWithDirectory(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	err = readConfig(dir, "")
+	Expect(err).To(MatchError(dir + ": is a directory"))
+}
+
 func TestReadConfigWithBadEnvironment(t *testing.T) {
 	RegisterTestingT(t)
 
 	err := readConfig(badEnvironmentConfigFile, "")
-	Expect(err).To(HaveOccurred())
+	Expect(err).To(MatchError(badEnvironmentConfigFile + ":4: login.environments: expected a mapping, found a list"))
 }
 
 func TestReadConfigWithMissingDefaultEnvironment(t *testing.T) {
@@ -119,3 +140,133 @@ func TestReadConfigWithExampleAndMissingEnvironment(t *testing.T) {
 	err := readConfig(exampleConfigFile, "development")
 	Expect(err).To(MatchError(exampleConfigFile + ": could not find environment: development"))
 }
+
+func TestReadConfigWithLayers(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	systemFile := filepath.Join(dir, "rsrdp.yml")
+	Expect(ioutil.WriteFile(systemFile, []byte("client:\n  executable: xfreerdp\n  shred: true\nremmina:\n  save: true\n"), 0600)).To(Succeed())
+	defer func(previous string) { configSystemFile = previous }(configSystemFile)
+	configSystemFile = systemFile
+	defer func(previous bool) { configProjectLookup = previous }(configProjectLookup)
+	configProjectLookup = true
+
+	project := filepath.Join(dir, "project")
+	Expect(os.MkdirAll(filepath.Join(project, "sub"), 0700)).To(Succeed())
+	projectFile := filepath.Join(project, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(projectFile, []byte("client:\n  options: [-f]\nremmina:\n  save: false\n"), 0600)).To(Succeed())
+
+	wd, err := os.Getwd()
+	Expect(err).NotTo(HaveOccurred())
+	userFile, err := filepath.Abs(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.Chdir(filepath.Join(project, "sub"))).To(Succeed())
+	defer os.Chdir(wd)
+
+	os.Setenv("RSRDP_CACHE_TTL", "1h")
+	defer os.Unsetenv("RSRDP_CACHE_TTL")
+
+	err = readConfig(userFile, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environment.Account).To(Equal(12345))
+
+	Expect(config.GetString("client.executable")).To(Equal("rdesktop"))
+	Expect(config.Origin("client.executable")).To(Equal(userFile))
+	Expect(config.GetStringSlice("client.options")).To(Equal([]string{"-f"}))
+	Expect(config.Origin("client.options")).To(Equal(projectFile))
+	Expect(config.GetBool("client.shred")).To(BeTrue())
+	Expect(config.GetBool("remmina.save")).To(BeFalse())
+	Expect(config.Origin("remmina.save")).To(Equal(projectFile))
+	Expect(config.GetString("remmina.gateway.server")).To(Equal("gateway.example.com"))
+	Expect(config.GetDuration("cache.ttl").String()).To(Equal("1h0m0s"))
+	Expect(config.Origin("cache.ttl")).To(Equal("$RSRDP_CACHE_TTL"))
+	Expect(config.Origin("login.environments.production.host")).To(Equal(userFile))
+}
+
+func TestReadConfigWithUnsafeProjectKeys(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	defer func(previous bool) { configProjectLookup = previous }(configProjectLookup)
+	configProjectLookup = true
+
+	projectFile := filepath.Join(dir, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(projectFile, []byte(`client:
+  executable: /tmp/evil
+  options: [-f]
+remmina:
+  share_folder: /
+login:
+  environments:
+    production:
+      host: evil.example.com
+      refresh_token_command: [/tmp/evil]
+      password:
+        provider: command
+        command: [/tmp/evil]
+usernames:
+- deployment: Project
+  username: project
+`), 0600)).To(Succeed())
+
+	wd, err := os.Getwd()
+	Expect(err).NotTo(HaveOccurred())
+	userFile, err := filepath.Abs(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.Chdir(dir)).To(Succeed())
+	defer os.Chdir(wd)
+
+	err = readConfig(userFile, "production")
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(config.GetString("client.executable")).To(Equal("rdesktop"))
+	Expect(config.Origin("client.executable")).To(Equal(userFile))
+	Expect(config.GetStringSlice("client.options")).To(Equal([]string{"-f"}))
+	Expect(config.Origin("client.options")).To(Equal(projectFile))
+	Expect(config.GetString("remmina.share_folder")).To(Equal("/home/user/Shared"))
+	Expect(config.Origin("remmina.share_folder")).To(Equal(userFile))
+	Expect(config.environment.Host).To(Equal("us-3.rightscale.com"))
+	Expect(config.environment.RefreshTokenCommand).To(BeEmpty())
+	Expect(config.environment.Password.Provider).To(BeEmpty())
+	Expect(config.Origin("login.environments.production.host")).To(Equal(userFile))
+	Expect(config.Origin("usernames")).To(Equal(projectFile))
+}
+
+func TestFindProjectConfigFileStopsBeforeHome(t *testing.T) {
+	RegisterTestingT(t)
+
+	home, err := ioutil.TempDir("", "home")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(home)
+	home, err = filepath.EvalSymlinks(home)
+	Expect(err).NotTo(HaveOccurred())
+
+	variable := "HOME"
+	if runtime.GOOS == "windows" {
+		variable = "USERPROFILE"
+	}
+	if value, ok := os.LookupEnv(variable); ok {
+		defer os.Setenv(variable, value)
+	} else {
+		defer os.Unsetenv(variable)
+	}
+	os.Setenv(variable, home)
+
+	project := filepath.Join(home, "src", "project")
+	Expect(os.MkdirAll(filepath.Join(project, "sub"), 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(home, ".rsrdp.yml"), []byte("login: {}\n"), 0600)).To(Succeed())
+
+	Expect(findProjectConfigFile(filepath.Join(project, "sub"))).To(BeEmpty())
+	Expect(findProjectConfigFile(home)).To(BeEmpty())
+
+	projectFile := filepath.Join(project, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(projectFile, []byte("client:\n  options: [-f]\n"), 0600)).To(Succeed())
+	Expect(findProjectConfigFile(filepath.Join(project, "sub"))).To(Equal(projectFile))
+}
@@ -25,15 +25,112 @@
 package main
 
 import (
+	"fmt"
+	"os"
 	"os/user"
 	"path/filepath"
+
+	"gopkg.in/inconshreveable/log15.v2"
 )
 
-func defaultConfigFile() string {
+func defaultConfigFile() (string, error) {
+	dir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, "config.yml")
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		legacy, err := legacyConfigFile()
+		if err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(legacy); err == nil {
+			log15.Warn("using legacy config file, run \"rsrdp config migrate\" to move it", "file", legacy, "destination", file)
+			return legacy, nil
+		}
+	}
+
+	return file, nil
+}
+
+func defaultSystemConfigFile() string {
+	return "/etc/rsrdp/rsrdp.yml"
+}
+
+func defaultCacheFile() (string, error) {
+	dir, err := xdgDir("XDG_CACHE_HOME", ".cache")
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "passwords.cache"), nil
+}
+
+func defaultStateDir() (string, error) {
+	return xdgDir("XDG_STATE_HOME", filepath.Join(".local", "state"))
+}
+
+func legacyConfigFile() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, ".rsrdp.yml"), nil
+}
+
+func configMigrations() ([]ConfigMigration, error) {
+	home, err := homeDir()
+	if err != nil {
+		return nil, err
+	}
+	configDir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return nil, err
+	}
+	cacheFile, err := defaultCacheFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return []ConfigMigration{
+		{filepath.Join(home, ".rsrdp.yml"), filepath.Join(configDir, "config.yml")},
+		{filepath.Join(home, ".rsrdp.cache"), cacheFile},
+	}, nil
+}
+
+func fileAccessibleByOthers(info os.FileInfo) bool {
+	return info.Mode().Perm()&0077 != 0
+}
+
+func fileWorldReadable(info os.FileInfo) bool {
+	return info.Mode().Perm()&0004 != 0
+}
+
+func xdgDir(variable, fallback string) (string, error) {
+	// the XDG Base Directory spec says relative paths are invalid and should be ignored
+	if dir := os.Getenv(variable); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "rsrdp"), nil
+	}
+
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, fallback, "rsrdp"), nil
+}
+
+func homeDir() (string, error) {
+	if home := os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+
 	currentUser, err := user.Current()
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("Error finding home directory: %s", err)
 	}
 
-	return filepath.Join(currentUser.HomeDir, ".rsrdp.yml")
+	return currentUser.HomeDir, nil
 }
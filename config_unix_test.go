@@ -0,0 +1,111 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDefaultConfigFileWithXDG(t *testing.T) {
+	RegisterTestingT(t)
+
+	home, err := ioutil.TempDir("", "home")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(home)
+	for _, variable := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME"} {
+		if value, ok := os.LookupEnv(variable); ok {
+			defer os.Setenv(variable, value)
+		} else {
+			defer os.Unsetenv(variable)
+		}
+		os.Unsetenv(variable)
+	}
+	os.Setenv("HOME", home)
+
+	configFile, err := defaultConfigFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configFile).To(Equal(filepath.Join(home, ".config", "rsrdp", "config.yml")))
+
+	cacheFile, err := defaultCacheFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cacheFile).To(Equal(filepath.Join(home, ".cache", "rsrdp", "passwords.cache")))
+
+	stateDir, err := defaultStateDir()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stateDir).To(Equal(filepath.Join(home, ".local", "state", "rsrdp")))
+
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	os.Setenv("XDG_CACHE_HOME", "relative")
+	os.Setenv("XDG_STATE_HOME", filepath.Join(home, "state"))
+	configFile, err = defaultConfigFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configFile).To(Equal(filepath.Join(home, "config", "rsrdp", "config.yml")))
+	cacheFile, err = defaultCacheFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cacheFile).To(Equal(filepath.Join(home, ".cache", "rsrdp", "passwords.cache")))
+	stateDir, err = defaultStateDir()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stateDir).To(Equal(filepath.Join(home, "state", "rsrdp")))
+}
+
+func TestDefaultConfigFileWithLegacyAndMigrate(t *testing.T) {
+	RegisterTestingT(t)
+
+	home, err := ioutil.TempDir("", "home")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(home)
+	for _, variable := range []string{"HOME", "XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_STATE_HOME"} {
+		if value, ok := os.LookupEnv(variable); ok {
+			defer os.Setenv(variable, value)
+		} else {
+			defer os.Unsetenv(variable)
+		}
+		os.Unsetenv(variable)
+	}
+	os.Setenv("HOME", home)
+
+	legacy := filepath.Join(home, ".rsrdp.yml")
+	Expect(ioutil.WriteFile(legacy, []byte("login: {}\n"), 0600)).To(Succeed())
+
+	configFile, err := defaultConfigFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configFile).To(Equal(legacy))
+
+	Expect(configMigrate()).To(Succeed())
+	Expect(legacy).NotTo(BeAnExistingFile())
+
+	configFile, err = defaultConfigFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(configFile).To(Equal(filepath.Join(home, ".config", "rsrdp", "config.yml")))
+	Expect(configFile).To(BeARegularFile())
+
+	Expect(ioutil.WriteFile(legacy, []byte("login: {}\n"), 0600)).To(Succeed())
+	Expect(configMigrate()).To(MatchError("Error migrating " + legacy + ": " + configFile + " already exists"))
+}
@@ -23,16 +23,71 @@
 package main
 
 import (
+	"fmt"
+	"os"
+	"os/user"
 	"path/filepath"
 
 	"github.com/douglaswth/rsrdp/win32"
 )
 
-func defaultConfigFile() string {
+func defaultConfigFile() (string, error) {
 	roamingPath, err := win32.SHGetKnownFolderPath(&win32.FOLDERID_RoamingAppData, 0, 0)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("Error finding roaming application data folder: %s", err)
 	}
 
-	return filepath.Join(roamingPath, "RSRDP", ".rsrdp.yml")
+	return filepath.Join(roamingPath, "RSRDP", ".rsrdp.yml"), nil
+}
+
+func defaultSystemConfigFile() string {
+	programDataPath, err := win32.SHGetKnownFolderPath(&win32.FOLDERID_ProgramData, 0, 0)
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(programDataPath, "RSRDP", "rsrdp.yml")
+}
+
+func defaultCacheFile() (string, error) {
+	localPath, err := win32.SHGetKnownFolderPath(&win32.FOLDERID_LocalAppData, 0, 0)
+	if err != nil {
+		return "", fmt.Errorf("Error finding local application data folder: %s", err)
+	}
+
+	return filepath.Join(localPath, "RSRDP", "rsrdp.cache"), nil
+}
+
+func defaultStateDir() (string, error) {
+	localPath, err := win32.SHGetKnownFolderPath(&win32.FOLDERID_LocalAppData, 0, 0)
+	if err != nil {
+		return "", fmt.Errorf("Error finding local application data folder: %s", err)
+	}
+
+	return filepath.Join(localPath, "RSRDP"), nil
+}
+
+func fileAccessibleByOthers(info os.FileInfo) bool {
+	return false
+}
+
+func fileWorldReadable(info os.FileInfo) bool {
+	return false
+}
+
+func configMigrations() ([]ConfigMigration, error) {
+	return nil, nil
+}
+
+func homeDir() (string, error) {
+	if home := os.Getenv("USERPROFILE"); home != "" {
+		return home, nil
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Error finding home directory: %s", err)
+	}
+
+	return currentUser.HomeDir, nil
 }
@@ -0,0 +1,290 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/inconshreveable/log15.v2"
+	"gopkg.in/rightscale/rsc.v4/httpclient"
+)
+
+const shardMaxRedirects = 5
+
+var (
+	shardScheme = "https"
+	shardClient = &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+)
+
+// ShardRecorder is the HTTP client of an environment's API clients; it does not follow redirects but remembers
+// where the last one pointed, which is how the API sends requests for an account to its shard
+type ShardRecorder struct {
+	httpclient.HTTPClient
+	mutex    sync.Mutex
+	location *neturl.URL
+}
+
+func newShardRecorder() *ShardRecorder {
+	return &ShardRecorder{HTTPClient: httpclient.NewNoRedirect()}
+}
+
+func (recorder *ShardRecorder) Do(request *http.Request) (*http.Response, error) {
+	response, err := recorder.HTTPClient.Do(request)
+	if err == nil {
+		recorder.record(response)
+	}
+	return response, err
+}
+
+func (recorder *ShardRecorder) DoHidden(request *http.Request) (*http.Response, error) {
+	response, err := recorder.HTTPClient.DoHidden(request)
+	if err == nil {
+		recorder.record(response)
+	}
+	return response, err
+}
+
+func (recorder *ShardRecorder) Location() *neturl.URL {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return recorder.location
+}
+
+func (recorder *ShardRecorder) record(response *http.Response) {
+	switch response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		location, err := response.Location()
+		if err != nil {
+			return
+		}
+		recorder.mutex.Lock()
+		recorder.location = location
+		recorder.mutex.Unlock()
+	}
+}
+
+func (environment *Environment) setAccounts(value interface{}) error {
+	environment.accounts, environment.allAccounts = nil, false
+
+	switch value := value.(type) {
+	case nil:
+	case string:
+		if value != "all" {
+			return fmt.Errorf("accounts: expected all or a list of accounts, found %q", value)
+		}
+		environment.allAccounts = true
+	case []interface{}:
+		for _, item := range value {
+			account, err := strconv.Atoi(fmt.Sprint(item))
+			if err != nil || account <= 0 {
+				return fmt.Errorf("accounts: expected a positive integer, found %v", item)
+			}
+			environment.accounts = append(environment.accounts, account)
+		}
+	default:
+		return fmt.Errorf("accounts: expected all or a list of accounts, found %v", value)
+	}
+
+	return nil
+}
+
+func (environment *Environment) hasAccount(account int) bool {
+	if environment.allAccounts {
+		return true
+	}
+	for _, environmentAccount := range environment.accounts {
+		if environmentAccount == account {
+			return true
+		}
+	}
+	return false
+}
+
+func (environment *Environment) forAccount(account int, host string) (*Environment, error) {
+	if !environment.trustsHost(host) {
+		return nil, fmt.Errorf("refusing to send credentials to %s: not a configured or RightScale host", host)
+	}
+
+	// resolve credentials once on the declaring environment so they are not prompted for again per account
+	switch environment.Auth.Mode {
+	case "", "refresh_token":
+		_, err := environment.getRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+	case "password":
+		_, err := environment.authPassword()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clone := *environment
+	clone.Account = account
+	clone.Host = host
+	clone.HostAliases = append([]string{environment.Host}, environment.HostAliases...)
+	clone.accounts, clone.allAccounts = nil, false
+	clone.shardResolved = false
+	clone.client15, clone.client16, clone.signer, clone.shards = nil, nil, nil, nil
+	clone.source = environment
+	if environment.source != nil {
+		clone.source = environment.source
+	}
+
+	return &clone, nil
+}
+
+func (environment *Environment) resolveShard() error {
+	auth, err := environment.authenticator()
+	if err != nil {
+		return err
+	}
+
+	environment.shardResolved = true
+	host := environment.Host
+	for redirects := 0; ; redirects++ {
+		href := fmt.Sprintf("%s://%s/api/accounts/%d", shardScheme, host, environment.Account)
+		request, err := http.NewRequest("GET", href, nil)
+		if err != nil {
+			return fmt.Errorf("Error finding shard: %s", err)
+		}
+		request.Header.Set("X-API-Version", "1.5")
+		auth.SetHost(host)
+		err = auth.Sign(request)
+		if err != nil {
+			return fmt.Errorf("Error authenticating: %s: %s", host, err)
+		}
+
+		response, err := shardClient.Do(request)
+		if err != nil {
+			return fmt.Errorf("Error finding shard: %s", err)
+		}
+		response.Body.Close()
+
+		switch response.StatusCode {
+		case http.StatusOK:
+			environment.Host = host
+			return nil
+		case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+			location, err := response.Location()
+			if err != nil {
+				return fmt.Errorf("Error finding shard: %s: %s", href, err)
+			}
+			if redirects == shardMaxRedirects {
+				return fmt.Errorf("Error finding shard: %s: too many redirects", href)
+			}
+			next := normalizeHost(location.Host)
+			if location.Scheme != shardScheme || !environment.trustsHost(next) {
+				return fmt.Errorf("Error finding shard: %s: refusing redirect to %s", href, location)
+			}
+			log15.Debug("following shard redirect", "account", environment.Account, "from", host, "to", next)
+			host = next
+		default:
+			return fmt.Errorf("Error finding shard: %s: %s", href, response.Status)
+		}
+	}
+}
+
+// followShardRedirect switches the environment to the shard an API request was redirected to, if any
+func (environment *Environment) followShardRedirect() bool {
+	if environment.shardResolved || environment.shards == nil {
+		return false
+	}
+	location := environment.shards.Location()
+	if location == nil {
+		return false
+	}
+
+	environment.shardResolved = true
+	host := normalizeHost(location.Host)
+	if location.Scheme != shardScheme || !environment.trustsHost(host) {
+		log15.Warn("refusing shard redirect", "account", environment.Account, "host", environment.Host, "location", location)
+		return false
+	}
+	if host == normalizeHost(environment.Host) {
+		return false
+	}
+
+	log15.Warn("account is on another shard, using it instead of the configured host", "account", environment.Account, "from", environment.Host, "to", host)
+	environment.Host = host
+	environment.client15, environment.client16, environment.shards = nil, nil, nil
+	return true
+}
+
+func (config *Config) discoverEnvironment(account int, host string) (*Environment, error) {
+	key := fmt.Sprintf("%d %s", account, host)
+	if environment, ok := config.discovered[key]; ok {
+		return environment, nil
+	}
+
+	var names []string
+	for _, name := range config.environmentNames() {
+		if config.environments[name].hasAccount(account) {
+			names = append(names, name)
+		}
+	}
+
+	// prefer environments that declare the same host as the URL
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		if normalizeHost(config.environments[name].Host) == host {
+			candidates = append(candidates, name)
+		}
+	}
+	for _, name := range names {
+		if normalizeHost(config.environments[name].Host) != host {
+			candidates = append(candidates, name)
+		}
+	}
+
+	var lastErr error
+	for _, name := range candidates {
+		environment, err := config.environments[name].forAccount(account, host)
+		if err == nil {
+			err = environment.resolveShard()
+		}
+		if err != nil {
+			log15.Debug("could not use environment for account", "environment", name, "account", account, "host", host, "error", err)
+			lastErr = err
+			continue
+		}
+
+		if config.discovered == nil {
+			config.discovered = make(map[string]*Environment)
+		}
+		config.discovered[key] = environment
+		return environment, nil
+	}
+
+	return nil, lastErr
+}
@@ -0,0 +1,204 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvironmentSetAccounts(t *testing.T) {
+	RegisterTestingT(t)
+
+	environment := &Environment{}
+	Expect(environment.setAccounts(nil)).To(Succeed())
+	Expect(environment.hasAccount(12346)).To(BeFalse())
+
+	Expect(environment.setAccounts("all")).To(Succeed())
+	Expect(environment.hasAccount(12346)).To(BeTrue())
+
+	Expect(environment.setAccounts([]interface{}{12346, "12347"})).To(Succeed())
+	Expect(environment.allAccounts).To(BeFalse())
+	Expect(environment.accounts).To(Equal([]int{12346, 12347}))
+	Expect(environment.hasAccount(12347)).To(BeTrue())
+	Expect(environment.hasAccount(12348)).To(BeFalse())
+
+	Expect(environment.setAccounts("some")).To(MatchError("accounts: expected all or a list of accounts, found \"some\""))
+	Expect(environment.setAccounts([]interface{}{0})).To(MatchError("accounts: expected a positive integer, found 0"))
+}
+
+func TestReadConfigWithAccounts(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "discovery")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yml")
+	Expect(ioutil.WriteFile(configFile, []byte(`login:
+  default_environment: production
+  environments:
+    production:
+      account: 12345
+      host: us-3.rightscale.com
+      refresh_token: abcdef1234567890abcdef1234567890abcdef12
+      accounts: all
+    staging:
+      account: 67890
+      host: us-4.rightscale.com
+      refresh_token: fedcba0987654321febcba0987654321fedcba09
+      accounts: [67891, 67892]
+`), 0600)).To(Succeed())
+
+	Expect(readConfig(configFile, "")).To(Succeed())
+	Expect(config.environments["production"].allAccounts).To(BeTrue())
+	Expect(config.environments["staging"].accounts).To(Equal([]int{67891, 67892}))
+
+	Expect(ioutil.WriteFile(configFile, []byte(`login:
+  default_environment: production
+  environments:
+    production:
+      account: 12345
+      host: us-3.rightscale.com
+      accounts: [12346]
+      auth:
+        mode: instance
+`), 0600)).To(Succeed())
+	Expect(readConfig(configFile, "")).To(MatchError(configFile + ": login.environments.production: accounts: cannot be used with the instance auth mode"))
+
+	Expect(ioutil.WriteFile(configFile, []byte(`login:
+  default_environment: production
+  environments:
+    production:
+      account: 12345
+      host: us-3.rightscale.com
+      refresh_token: abcdef1234567890abcdef1234567890abcdef12
+      accounts: some
+`), 0600)).To(Succeed())
+	Expect(readConfig(configFile, "")).To(MatchError(configFile + ":8: login.environments.production.accounts: expected all or a list of accounts, found \"some\""))
+}
+
+func TestConfigGetEnvironmentWithAccounts(t *testing.T) {
+	RegisterTestingT(t)
+
+	shard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/accounts/12346" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer shard.Close()
+	shardURL, _ := neturl.Parse(shard.URL)
+
+	my := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, shard.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer my.Close()
+	myURL, _ := neturl.Parse(my.URL)
+
+	defer func(previous string) { shardScheme = previous }(shardScheme)
+	shardScheme = "http"
+
+	config := &Config{environments: map[string]*Environment{
+		"production": {Account: 12345, Host: myURL.Host, HostAliases: []string{shardURL.Host}, Auth: testingAccessToken, allAccounts: true},
+		"staging":    {Account: 67890, Host: "us-4.rightscale.com", Auth: testingAccessToken, accounts: []int{67891}},
+	}}
+
+	environment, err := config.getEnvironment(12345, myURL.Host)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(environment).To(BeIdenticalTo(config.environments["production"]))
+
+	environment, err = config.getEnvironment(12346, myURL.Host)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(environment.Account).To(Equal(12346))
+	Expect(environment.Host).To(Equal(shardURL.Host))
+	Expect(environment.Auth).To(Equal(testingAccessToken))
+	Expect(environment.allAccounts).To(BeFalse())
+	Expect(config.environments["production"].Account).To(Equal(12345))
+
+	again, err := config.getEnvironment(12346, myURL.Host)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(again).To(BeIdenticalTo(environment))
+
+	_, err = config.getEnvironment(12347, myURL.Host)
+	Expect(err).To(MatchError("Error finding environment for account/host: 12347 " + myURL.Host + ": Error finding shard: " + shard.URL + "/api/accounts/12347: 403 Forbidden"))
+
+	_, err = config.getEnvironment(12346, "evil.example")
+	Expect(err).To(MatchError("Error finding environment for account/host: 12346 evil.example: refusing to send credentials to evil.example: not a configured or RightScale host"))
+
+	delete(config.environments, "production")
+	_, err = config.getEnvironment(12346, myURL.Host)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = config.getEnvironment(12348, myURL.Host)
+	Expect(err).To(MatchError("Error finding environment for account/host: 12348 " + myURL.Host))
+}
+
+func TestEnvironmentResolveShardWithRedirectLoop(t *testing.T) {
+	RegisterTestingT(t)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+r.URL.Path, http.StatusMovedPermanently)
+	}))
+	defer server.Close()
+	serverURL, _ := neturl.Parse(server.URL)
+
+	defer func(previous string) { shardScheme = previous }(shardScheme)
+	shardScheme = "http"
+
+	environment := &Environment{Account: 12346, Host: serverURL.Host, Auth: testingAccessToken}
+	Expect(environment.resolveShard()).To(MatchError("Error finding shard: " + server.URL + "/api/accounts/12346: too many redirects"))
+}
+
+func TestEnvironmentResolveShardWithUntrustedRedirect(t *testing.T) {
+	RegisterTestingT(t)
+
+	signed := false
+	evil := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signed = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer evil.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, evil.URL+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+	serverURL, _ := neturl.Parse(server.URL)
+
+	defer func(previous string) { shardScheme = previous }(shardScheme)
+	shardScheme = "http"
+
+	environment := &Environment{Account: 12346, Host: serverURL.Host, Auth: testingAccessToken}
+	Expect(environment.resolveShard()).To(MatchError("Error finding shard: " + server.URL + "/api/accounts/12346: refusing redirect to " + evil.URL + "/api/accounts/12346"))
+	Expect(signed).To(BeFalse())
+	Expect(environment.Host).To(Equal(serverURL.Host))
+}
@@ -0,0 +1,139 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+func envAdd(configFile, name, host string, account int, makeDefault bool) error {
+	if account == 0 {
+		return fmt.Errorf("Error adding environment: %s: no account given (use --account)", name)
+	}
+	if host == "" {
+		return fmt.Errorf("Error adding environment: %s: no host given (use --host)", name)
+	}
+
+	refreshToken, err := readPassphrase("RSRDP_REFRESH_TOKEN", "RightScale refresh token: ")
+	if err != nil {
+		return err
+	}
+
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+
+	environment := &Environment{Account: account, Host: host, RefreshToken: strings.TrimSpace(string(refreshToken))}
+	err = document.AddEnvironment(name, environment, makeDefault)
+	if err != nil {
+		return err
+	}
+	err = encryptNewSecrets(document)
+	if err != nil {
+		return err
+	}
+
+	return document.Save()
+}
+
+func envRemove(configFile, name string) error {
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+
+	if name == document.DefaultEnvironment() && len(document.EnvironmentNames()) > 1 {
+		return fmt.Errorf("Error removing environment: %s: environment is the default environment (set another default first)", name)
+	}
+
+	err = document.RemoveEnvironment(name)
+	if err != nil {
+		return err
+	}
+
+	return document.Save()
+}
+
+func envSetDefault(configFile, name string) error {
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+
+	err = document.SetDefaultEnvironment(name)
+	if err != nil {
+		return err
+	}
+
+	return document.Save()
+}
+
+func envList() error {
+	defaultEnvironment := config.GetString("login.default_environment")
+	for _, name := range config.environmentNames() {
+		environment := config.environments[name]
+		marker := " "
+		if name == defaultEnvironment {
+			marker = "*"
+		}
+		fmt.Printf("%s %-20s %-10d %s\n", marker, name, environment.Account, environment.Host)
+	}
+
+	return nil
+}
+
+func envTest() error {
+	names := config.environmentNames()
+	errChans := make([]chan error, len(names))
+	for errChanIndex, name := range names {
+		errChans[errChanIndex] = make(chan error, 1)
+		go func(errChanIndex int, environment *Environment) {
+			accounts, err := setupListAccounts(environment)
+			if err == nil {
+				if _, ok := accounts[environment.Account]; !ok {
+					err = fmt.Errorf("refresh token does not have access to account %d", environment.Account)
+				}
+			}
+			errChans[errChanIndex] <- err
+		}(errChanIndex, config.environments[name])
+	}
+
+	failures := 0
+	for errChanIndex, name := range names {
+		err := <-errChans[errChanIndex]
+		if err != nil {
+			failures++
+			fmt.Printf("%-20s FAILED: %s\n", name, err)
+		} else {
+			fmt.Printf("%-20s ok\n", name)
+		}
+	}
+
+	if failures != 0 {
+		return fmt.Errorf("Error testing environments: %d of %d failed (the refresh token may be invalid or expired)", failures, len(names))
+	}
+
+	return nil
+}
@@ -23,31 +23,118 @@
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
 	"gopkg.in/rightscale/rsc.v4/cm15"
 	"gopkg.in/rightscale/rsc.v4/cm16"
 	"gopkg.in/rightscale/rsc.v4/rsapi"
 )
 
 type Environment struct {
-	Account      int
-	Host         string
-	RefreshToken string `mapstructure:"refresh_token"`
-	client15     *cm15.API
-	client16     *cm16.API
+	Account             int
+	Host                string
+	HostAliases         []string `mapstructure:"host_aliases"`
+	RefreshToken        string   `mapstructure:"refresh_token"`
+	RefreshTokenCommand []string `mapstructure:"refresh_token_command"`
+	RefreshTokenEnv     string   `mapstructure:"refresh_token_env"`
+	RefreshTokenFile    string   `mapstructure:"refresh_token_file"`
+	Auth                AuthConfig
+	Password            PasswordConfig
+	accounts            []int
+	allAccounts         bool
+	shardResolved       bool
+	refreshToken        string
+	client15            *cm15.API
+	client16            *cm16.API
+	signer              rsapi.Authenticator
+	shards              *ShardRecorder
+	resolver            Resolver
+	source              *Environment
 }
 
-func (environment *Environment) Client15() *cm15.API {
+func (environment *Environment) Client15() (*cm15.API, error) {
 	if environment.client15 == nil {
-		auth := rsapi.NewOAuthAuthenticator(environment.RefreshToken, environment.Account)
+		auth, err := environment.authenticator()
+		if err != nil {
+			return nil, err
+		}
 		environment.client15 = cm15.New(environment.Host, auth)
+		environment.client15.Client = environment.shardRecorder()
 	}
-	return environment.client15
+	return environment.client15, nil
 }
 
-func (environment *Environment) Client16() *cm16.API {
+func (environment *Environment) Client16() (*cm16.API, error) {
 	if environment.client16 == nil {
-		auth := rsapi.NewOAuthAuthenticator(environment.RefreshToken, environment.Account)
+		auth, err := environment.authenticator()
+		if err != nil {
+			return nil, err
+		}
 		environment.client16 = cm16.New(environment.Host, auth)
+		environment.client16.Client = environment.shardRecorder()
+	}
+	return environment.client16, nil
+}
+
+func (environment *Environment) shardRecorder() *ShardRecorder {
+	if environment.shards == nil {
+		environment.shards = newShardRecorder()
+	}
+	return environment.shards
+}
+
+func (environment *Environment) getRefreshToken() (string, error) {
+	if environment.refreshToken != "" {
+		return environment.refreshToken, nil
 	}
-	return environment.client16
+
+	var refreshToken string
+	switch {
+	case environment.RefreshToken != "":
+		refreshToken = environment.RefreshToken
+	case len(environment.RefreshTokenCommand) != 0:
+		command := exec.Command(environment.RefreshTokenCommand[0], environment.RefreshTokenCommand[1:]...)
+		command.Stdin = os.Stdin
+		command.Stderr = os.Stderr
+		terminalMutex.Lock()
+		output, err := command.Output()
+		terminalMutex.Unlock()
+		if err != nil {
+			return "", fmt.Errorf("Error running refresh token command: %s: %s", environment.RefreshTokenCommand[0], err)
+		}
+		refreshToken = strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+		if refreshToken == "" {
+			return "", fmt.Errorf("Error running refresh token command: %s: no refresh token on standard output", environment.RefreshTokenCommand[0])
+		}
+	case environment.RefreshTokenEnv != "":
+		refreshToken = strings.TrimSpace(os.Getenv(environment.RefreshTokenEnv))
+		if refreshToken == "" {
+			return "", fmt.Errorf("Error reading refresh token: environment variable %s is not set", environment.RefreshTokenEnv)
+		}
+	case environment.RefreshTokenFile != "":
+		info, err := os.Stat(environment.RefreshTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("Error reading refresh token file: %s", err)
+		}
+		if fileAccessibleByOthers(info) {
+			return "", fmt.Errorf("Error reading refresh token file: %s: file is accessible by group or others (mode %s), run chmod 600 on it", environment.RefreshTokenFile, info.Mode().Perm())
+		}
+		content, err := ioutil.ReadFile(environment.RefreshTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("Error reading refresh token file: %s", err)
+		}
+		refreshToken = strings.TrimSpace(string(content))
+		if refreshToken == "" {
+			return "", fmt.Errorf("Error reading refresh token file: %s: file is empty", environment.RefreshTokenFile)
+		}
+	default:
+		return "", fmt.Errorf("Error reading refresh token: no refresh_token, refresh_token_command, refresh_token_env or refresh_token_file for account %d", environment.Account)
+	}
+
+	environment.refreshToken = refreshToken
+	return refreshToken, nil
 }
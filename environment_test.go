@@ -24,6 +24,10 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -35,24 +39,89 @@ var testingEnvironment = Environment{
 	RefreshToken: "def1234567890abcdef1234567890abcdef12345",
 }
 
+// signs requests without logging in first, for tests that talk to a fake API endpoint
+var testingAccessToken = AuthConfig{Mode: "access_token", AccessToken: "abcdef1234567890abcdef1234567890abcdef12"}
+
 func TestEnvironmentClient15(t *testing.T) {
 	RegisterTestingT(t)
 
-	firstClient := testingEnvironment.Client15()
+	firstClient, err := testingEnvironment.Client15()
+	Expect(err).NotTo(HaveOccurred())
 	Expect(firstClient).NotTo(BeNil())
 	Expect(fmt.Sprintln(firstClient)).To(Equal(fmt.Sprintln(testingEnvironment.client15)))
 
-	secondClient := testingEnvironment.Client15()
+	secondClient, err := testingEnvironment.Client15()
+	Expect(err).NotTo(HaveOccurred())
 	Expect(fmt.Sprintln(secondClient)).To(Equal(fmt.Sprintln(firstClient)))
 }
 
 func TestEnvironmentClient16(t *testing.T) {
 	RegisterTestingT(t)
 
-	firstClient := testingEnvironment.Client16()
+	firstClient, err := testingEnvironment.Client16()
+	Expect(err).NotTo(HaveOccurred())
 	Expect(firstClient).NotTo(BeNil())
 	Expect(fmt.Sprintln(firstClient)).To(Equal(fmt.Sprintln(testingEnvironment.client16)))
 
-	secondClient := testingEnvironment.Client16()
+	secondClient, err := testingEnvironment.Client16()
+	Expect(err).NotTo(HaveOccurred())
 	Expect(fmt.Sprintln(secondClient)).To(Equal(fmt.Sprintln(firstClient)))
 }
+
+func TestEnvironmentRefreshTokenEnv(t *testing.T) {
+	RegisterTestingT(t)
+
+	environment := &Environment{Account: 54321, Host: "localhost", RefreshTokenEnv: "RSRDP_TEST_REFRESH_TOKEN"}
+	_, err := environment.Client15()
+	Expect(err).To(MatchError("Error reading refresh token: environment variable RSRDP_TEST_REFRESH_TOKEN is not set"))
+
+	os.Setenv("RSRDP_TEST_REFRESH_TOKEN", testingEnvironment.RefreshToken+"\n")
+	defer os.Unsetenv("RSRDP_TEST_REFRESH_TOKEN")
+	refreshToken, err := environment.getRefreshToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(refreshToken).To(Equal(testingEnvironment.RefreshToken))
+}
+
+func TestEnvironmentRefreshTokenFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "environment")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "refresh_token")
+	Expect(ioutil.WriteFile(file, []byte(testingEnvironment.RefreshToken+"\n"), 0644)).To(Succeed())
+
+	environment := &Environment{Account: 54321, Host: "localhost", RefreshTokenFile: file}
+	if runtime.GOOS != "windows" {
+		_, err = environment.getRefreshToken()
+		Expect(err).To(MatchError("Error reading refresh token file: " + file + ": file is accessible by group or others (mode -rw-r--r--), run chmod 600 on it"))
+		Expect(os.Chmod(file, 0600)).To(Succeed())
+	}
+
+	refreshToken, err := environment.getRefreshToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(refreshToken).To(Equal(testingEnvironment.RefreshToken))
+}
+
+func TestEnvironmentRefreshTokenCommand(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Setenv("RSRDP_PASSWORD_HELPER", "1")
+	defer os.Unsetenv("RSRDP_PASSWORD_HELPER")
+
+	environment := &Environment{Account: 54321, Host: "localhost", RefreshTokenCommand: []string{os.Args[0], "-test.run=TestPasswordHelperProcess", "--", "token"}}
+	refreshToken, err := environment.getRefreshToken()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(refreshToken).To(Equal("token-password"))
+
+	environment.refreshToken = ""
+	terminalMutex.Lock()
+	done := make(chan string, 1)
+	go func() {
+		refreshToken, _ := environment.getRefreshToken()
+		done <- refreshToken
+	}()
+	Consistently(done).ShouldNot(Receive())
+	terminalMutex.Unlock()
+	Eventually(done, "5s").Should(Receive(Equal("token-password")))
+}
@@ -0,0 +1,79 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"net"
+	neturl "net/url"
+	"sort"
+	"strings"
+)
+
+// dashboard entry points that serve every account and redirect to its shard
+var rightscaleGlobalHosts = []string{"my.rightscale.com"}
+
+func normalizeHost(host string) string {
+	if strings.Contains(host, "://") {
+		if url, err := neturl.Parse(host); err == nil {
+			host = url.Host
+		}
+	}
+
+	host = strings.ToLower(strings.TrimSpace(host))
+	if hostname, port, err := net.SplitHostPort(host); err == nil && port == "443" {
+		host = hostname
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+func (environment *Environment) hasHostAlias(host string) bool {
+	for _, alias := range environment.HostAliases {
+		if normalizeHost(alias) == host {
+			return true
+		}
+	}
+	for _, global := range rightscaleGlobalHosts {
+		if global == host {
+			return true
+		}
+	}
+	return false
+}
+
+func isRightScaleHost(host string) bool {
+	return strings.HasSuffix(host, ".rightscale.com")
+}
+
+// trustsHost reports whether credentials for the environment may be sent to host
+func (environment *Environment) trustsHost(host string) bool {
+	return normalizeHost(environment.Host) == host || environment.hasHostAlias(host) || isRightScaleHost(host)
+}
+
+func (config *Config) environmentNames() []string {
+	names := make([]string, 0, len(config.environments))
+	for name := range config.environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
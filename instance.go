@@ -24,6 +24,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"gopkg.in/inconshreveable/log15.v2"
@@ -45,6 +46,57 @@ func (instance *Instance) Href() string {
 	panic(fmt.Errorf("No self href for instance: links %s", instance.Links))
 }
 
+func (instance *Instance) DeploymentName() (string, error) {
+	for _, link := range instance.Links {
+		if link["rel"] == "deployment" {
+			deployment, err := instance.Resolver().Deployment(link["href"])
+			if err != nil {
+				return "", err
+			}
+			return deployment.Name, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (instance *Instance) ServerName() (string, error) {
+	for _, link := range instance.Links {
+		if link["rel"] != "parent" {
+			continue
+		}
+		switch href := link["href"]; {
+		case strings.Contains(href, "/server_arrays/"):
+			array, err := instance.Resolver().ServerArray(href)
+			if err != nil {
+				return "", err
+			}
+			return array.Name, nil
+		case strings.Contains(href, "/servers/"):
+			server, err := instance.Resolver().Server(href)
+			if err != nil {
+				return "", err
+			}
+			return server.Name, nil
+		}
+	}
+
+	return instance.Name, nil
+}
+
+func (instance *Instance) Tags() ([]string, error) {
+	return instance.Resolver().Tags(instance.Href())
+}
+
+func (instance *Instance) Password() (string, error) {
+	provider, err := instance.Environment.Password.PasswordProvider()
+	if err != nil {
+		return "", err
+	}
+
+	return provider.Password(instance)
+}
+
 func (instance *Instance) IpAddress(private bool, index int) (string, error) {
 	ipAddresses := instance.PublicIpAddresses
 	if private {
@@ -63,10 +115,22 @@ func (instance *Instance) Wait(private bool, index int, prompt bool, timeout, in
 	go func() {
 		for {
 			_, err := instance.IpAddress(private, 0)
-			if err == nil && (prompt || instance.AdminPassword != "") {
+			if err == nil && prompt {
 				errChan <- nil
 				return
 			}
+			if err == nil {
+				password, err := instance.Password()
+				if err != nil {
+					errChan <- err
+					return
+				}
+				if password != "" {
+					instance.AdminPassword = password
+					errChan <- nil
+					return
+				}
+			}
 
 			log15.Info("waiting for IP address and/or Administrator password", "instance", instance.Href(), "interval", interval)
 			time.Sleep(interval)
@@ -0,0 +1,109 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// +build !darwin,!windows
+
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+
+	"github.com/godbus/dbus"
+
+	"github.com/douglaswth/rsrdp/secretservice"
+)
+
+func keyringStoreRemminaPassword(file, password string) (string, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return "", fmt.Errorf("Error connecting to D-Bus session bus: %s", err)
+	}
+
+	service, err := secretservice.New(conn)
+	if err != nil {
+		return "", err
+	}
+	defer service.Close()
+
+	attributes := map[string]string{
+		"xdg:schema": "org.remmina.Password",
+		"filename":   file,
+		"key":        "password",
+	}
+	// the session collection lives in memory, so the password is gone at logout even if the temporary directory
+	// holding the Remmina file is never cleaned up
+	item, err := service.CreateItem(secretservice.SessionCollection, "Remmina: "+filepath.Base(file)+" - password", attributes, password)
+	if err != nil {
+		return "", err
+	}
+
+	return string(item), nil
+}
+
+func keyringCacheKey() ([]byte, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to D-Bus session bus: %s", err)
+	}
+
+	service, err := secretservice.New(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer service.Close()
+
+	attributes := map[string]string{
+		"application": "rsrdp",
+		"key":         "cache",
+	}
+	items, err := service.SearchItems(attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) != 0 {
+		secret, err := service.GetSecret(items[0])
+		if err != nil {
+			return nil, err
+		}
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding cache key: %s", err)
+		}
+		return key, nil
+	}
+
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return nil, fmt.Errorf("Error generating cache key: %s", err)
+	}
+	_, err = service.CreateItem(secretservice.DefaultCollection, "RSRDP cache key", attributes, base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
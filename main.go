@@ -25,7 +25,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
 
 	"github.com/mattn/go-colorable"
 
@@ -36,7 +38,7 @@ import (
 
 var (
 	app         = kingpin.New("rsrdp", "Launch Windows Remote Desktop for a RightScale Server, ServerArray, or Instance.")
-	configFile  = app.Flag("config", "Set the config file path.").Short('c').Default(defaultConfigFile()).String()
+	configFile  = app.Flag("config", "Set the config file path (defaults to $XDG_CONFIG_HOME/rsrdp/config.yml, or %APPDATA%\\RSRDP\\.rsrdp.yml on Windows).").Short('c').String()
 	environment = app.Flag("environment", "Set the RightScale login environment.").Short('e').String()
 	account     = app.Flag("account", "Set the RightScale account ID.").Short('a').Int()
 	host        = app.Flag("host", "RightScale login endpoint (e.g. 'us-3.rightscale.com')").Short('h').String()
@@ -44,10 +46,40 @@ var (
 	index       = app.Flag("index", "Connect using the indexed public/private interface of the Server, ServerArray, or Instance.").Short('i').Int()
 	arguments   = app.Flag("argument", "Argument to the Remote Desktop command (specify multiple times for multiple arguments)").Short('A').Strings()
 	prompt      = app.Flag("prompt", "Prompt for a username and password when launching Windows Remote Desktop rather than using the initial Adminstrator password from RightScale.").Short('P').Bool()
-	username    = app.Flag("username", "The username to connect with").Default("Administrator").Short('u').String()
+	username    = app.Flag("username", "The username to connect with, optionally as DOMAIN\\user (defaults to the first matching username rule in the config file or Administrator)").Short('u').String()
+	open        = app.Flag("open", "Open the RDP file with the desktop default handler (e.g. xdg-open) instead of a Remote Desktop client.").Short('o').Bool()
+	wait        = app.Flag("wait", "Wait for all of the Remote Desktop sessions to end before exiting, forwarding interrupt and termination signals to them.").Short('w').Bool()
 	timeout     = app.Flag("timeout", "The amount to wait for the Server, ServerArray, or Instance to have an IP address and/or Administrator password").Short('t').Default("5m").Duration()
 	interval    = app.Flag("interval", "The amount of time between retries when waiting for the Server, ServerArray, or Instance to have an IP address and/or Administrator password").Short('I').Default("10s").Duration()
-	urls        = app.Arg("url", "RightScale Server, ServerArray, or Instance URL").Required().Strings()
+
+	launchCommand = app.Command("launch", "Launch Windows Remote Desktop for RightScale Servers, ServerArrays, or Instances.").Default()
+	urls          = launchCommand.Arg("url", "RightScale Server, ServerArray, or Instance URL").Required().Strings()
+
+	setupCommand = app.Command("setup", "Interactively add a RightScale login environment to the config file.")
+
+	envCommand        = app.Command("env", "Manage the RightScale login environments in the config file.")
+	envListCommand    = envCommand.Command("list", "List the RightScale login environments.")
+	envAddCommand     = envCommand.Command("add", "Add or replace a RightScale login environment using --account and --host (the refresh token is read from $RSRDP_REFRESH_TOKEN or prompted for).")
+	envAddName        = envAddCommand.Arg("name", "Name of the environment").Required().String()
+	envAddDefault     = envAddCommand.Flag("default", "Make the environment the default environment").Bool()
+	envRemoveCommand  = envCommand.Command("remove", "Remove a RightScale login environment.")
+	envRemoveName     = envRemoveCommand.Arg("name", "Name of the environment").Required().String()
+	envDefaultCommand = envCommand.Command("default", "Set the default RightScale login environment.")
+	envDefaultName    = envDefaultCommand.Arg("name", "Name of the environment").Required().String()
+	envTestCommand    = envCommand.Command("test", "Check that the refresh token of every RightScale login environment can authenticate.")
+
+	configCommand        = app.Command("config", "Inspect the config file.")
+	configCheckCommand   = configCommand.Command("check", "Validate the config file, reporting every problem with its line number.")
+	configEncryptCommand = configCommand.Command("encrypt", "Encrypt the refresh tokens in the config file in place with a passphrase (read from $RSRDP_PASSPHRASE or prompted for).")
+	configDecryptCommand = configCommand.Command("decrypt", "Decrypt the encrypted values in the config file in place.")
+	configMigrateCommand = configCommand.Command("migrate", "Move config and cache files from their legacy locations to the XDG Base Directory locations.")
+	configShowCommand    = configCommand.Command("show", "Print the effective configuration merged from the system, user and project config files and $RSRDP_* environment variables.")
+	configShowOrigin     = configShowCommand.Flag("origin", "Print the file or environment variable each value comes from").Bool()
+
+	syncCommand   = app.Command("sync", "Write Remote Desktop connection profiles for the Windows Servers and ServerArrays in every RightScale login environment.")
+	syncDirectory = syncCommand.Arg("directory", "Directory to write connection profiles to").Required().String()
+	syncFormat    = syncCommand.Flag("format", "Connection profile format to write (rdp, remmina, or both)").Short('f').Default("rdp").Enum("rdp", "remmina", "both")
+	syncPrune     = syncCommand.Flag("prune", "Delete connection profiles written by a previous sync for Servers and ServerArrays that no longer exist or have no running Instances").Default("true").Bool()
 )
 
 func main() {
@@ -56,36 +88,110 @@ func main() {
 	log.Logger.SetHandler(handler)
 
 	app.Writer(os.Stdout)
-	kingpin.MustParse(app.Parse(os.Args[1:]))
-	err := readConfig(*configFile, *environment)
+	command := kingpin.MustParse(app.Parse(os.Args[1:]))
+
+	var err error
+	if *configFile == "" {
+		*configFile, err = defaultConfigFile()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error finding config file: %s\n", filepath.Base(os.Args[0]), err)
+			os.Exit(1)
+		}
+	}
+
+	switch command {
+	case setupCommand.FullCommand():
+		err = setup(*configFile, *environment, *host, *account)
+	case envAddCommand.FullCommand():
+		err = envAdd(*configFile, *envAddName, *host, *account, *envAddDefault)
+	case envRemoveCommand.FullCommand():
+		err = envRemove(*configFile, *envRemoveName)
+	case envDefaultCommand.FullCommand():
+		err = envSetDefault(*configFile, *envDefaultName)
+	case configCheckCommand.FullCommand():
+		err = configCheck(*configFile)
+	case configEncryptCommand.FullCommand():
+		err = configEncrypt(*configFile)
+	case configDecryptCommand.FullCommand():
+		err = configDecrypt(*configFile)
+	case configMigrateCommand.FullCommand():
+		err = configMigrate()
+	default:
+		err = readConfig(*configFile, *environment)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error reading config file: %s\n", filepath.Base(os.Args[0]), err)
+			if _, statErr := os.Stat(*configFile); os.IsNotExist(statErr) {
+				fmt.Fprintf(os.Stderr, "%s: Run \"%s setup\" to create one\n", filepath.Base(os.Args[0]), filepath.Base(os.Args[0]))
+			}
+			os.Exit(1)
+		}
+
+		switch command {
+		case launchCommand.FullCommand():
+			openCacheOrWarn()
+			sweepTemporaryDirs(os.TempDir())
+			if parent := rdpTemporaryParent(); parent != os.TempDir() {
+				sweepTemporaryDirs(parent)
+			}
+			err = launch()
+		case syncCommand.FullCommand():
+			openCacheOrWarn()
+			err = syncProfiles(*syncDirectory, *syncFormat, *syncPrune, *private, *index, *prompt, *username)
+		case envListCommand.FullCommand():
+			err = envList()
+		case envTestCommand.FullCommand():
+			err = envTest()
+		case configShowCommand.FullCommand():
+			err = configShow(*configShowOrigin)
+		}
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: Error reading config file: %s\n", filepath.Base(os.Args[0]), err)
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err)
 		os.Exit(1)
 	}
+}
+
+func openCacheOrWarn() {
+	var err error
+	cache, err = openCache()
+	if err != nil {
+		log15.Warn("could not open admin password cache, continuing without it", "error", err)
+		cache = nil
+	}
+}
 
+func launch() error {
 	instances, err := urlsToInstances(*urls, *prompt)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err)
-		os.Exit(1)
+		return err
+	}
+
+	if *wait {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(signals)
+		go rdpForwardSignals(signals)
 	}
 
 	errChans := make([]chan error, len(instances))
 	for errChanIndex, instance := range instances {
 		errChans[errChanIndex] = make(chan error)
 		go func(errChanIndex int, instance *Instance) {
-			errChans[errChanIndex] <- rdpLaunch(instance, *private, *index, *arguments, *prompt, *username, *timeout, *interval)
+			errChans[errChanIndex] <- rdpLaunch(instance, *private, *index, *arguments, *prompt, *username, *open, *wait, *timeout, *interval)
 		}(errChanIndex, instance)
 	}
 
-	errs := false
+	errs := 0
 	for _, errChan := range errChans {
 		err = <-errChan
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err)
-			errs = true
+			errs++
 		}
 	}
-	if errs {
-		os.Exit(1)
+	if errs != 0 {
+		return fmt.Errorf("Error launching Windows Remote Desktop: %d of %d failed", errs, len(instances))
 	}
+
+	return nil
 }
@@ -0,0 +1,207 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+type PasswordProvider interface {
+	Password(instance *Instance) (string, error)
+}
+
+type PasswordConfig struct {
+	Provider   string
+	Credential string
+	Command    []string
+	Variable   string
+	Input      string
+}
+
+type RightScalePasswordProvider struct{}
+
+type CredentialPasswordProvider struct {
+	Name string
+}
+
+type InputPasswordProvider struct {
+	Input string
+}
+
+type CommandPasswordProvider struct {
+	Command []string
+}
+
+type EnvironmentPasswordProvider struct {
+	Variable string
+}
+
+func (passwordConfig *PasswordConfig) PasswordProvider() (PasswordProvider, error) {
+	switch passwordConfig.Provider {
+	case "", "rightscale":
+		return &RightScalePasswordProvider{}, nil
+	case "credential":
+		if passwordConfig.Credential == "" {
+			return nil, fmt.Errorf("Error configuring password provider: credential: no credential name pattern")
+		}
+		return &CredentialPasswordProvider{passwordConfig.Credential}, nil
+	case "input":
+		if passwordConfig.Input == "" {
+			return &InputPasswordProvider{"ADMIN_PASSWORD"}, nil
+		}
+		return &InputPasswordProvider{passwordConfig.Input}, nil
+	case "command":
+		if len(passwordConfig.Command) == 0 {
+			return nil, fmt.Errorf("Error configuring password provider: command: no command")
+		}
+		return &CommandPasswordProvider{passwordConfig.Command}, nil
+	case "environment":
+		if passwordConfig.Variable == "" {
+			return nil, fmt.Errorf("Error configuring password provider: environment: no variable")
+		}
+		return &EnvironmentPasswordProvider{passwordConfig.Variable}, nil
+	default:
+		return nil, fmt.Errorf("Error configuring password provider: unsupported provider: %s", passwordConfig.Provider)
+	}
+}
+
+func (provider *RightScalePasswordProvider) Password(instance *Instance) (string, error) {
+	return instance.AdminPassword, nil
+}
+
+func (provider *CredentialPasswordProvider) Password(instance *Instance) (string, error) {
+	name, err := passwordExpand(provider.Name, instance)
+	if err != nil {
+		return "", err
+	}
+
+	return passwordGetCredential(instance.Environment, name)
+}
+
+func (provider *InputPasswordProvider) Password(instance *Instance) (string, error) {
+	inputs, err := instance.Resolver().Inputs(instance.Href())
+	if err != nil {
+		return "", err
+	}
+
+	for _, input := range inputs {
+		if input.Name != provider.Input {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(input.Value, "cred:"):
+			return passwordGetCredential(instance.Environment, strings.TrimPrefix(input.Value, "cred:"))
+		case strings.HasPrefix(input.Value, "text:") && input.Value != "text:":
+			return strings.TrimPrefix(input.Value, "text:"), nil
+		default:
+			log15.Debug("input does not reference a credential, using Administrator password", "instance", instance.Href(), "input", provider.Input, "value", input.Value)
+			return instance.AdminPassword, nil
+		}
+	}
+
+	log15.Debug("input not found, using Administrator password", "instance", instance.Href(), "input", provider.Input)
+	return instance.AdminPassword, nil
+}
+
+func (provider *CommandPasswordProvider) Password(instance *Instance) (string, error) {
+	args := make([]string, len(provider.Command))
+	for index, arg := range provider.Command {
+		var err error
+		args[index], err = passwordExpand(arg, instance)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	command := exec.Command(args[0], args[1:]...)
+	command.Stdin = os.Stdin
+	command.Stderr = os.Stderr
+	terminalMutex.Lock()
+	output, err := command.Output()
+	terminalMutex.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("Error running password command: %s: %s", args[0], err)
+	}
+
+	password := strings.SplitN(string(output), "\n", 2)[0]
+	password = strings.TrimSuffix(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("Error running password command: %s: no password on standard output", args[0])
+	}
+
+	return password, nil
+}
+
+func (provider *EnvironmentPasswordProvider) Password(instance *Instance) (string, error) {
+	password := os.Getenv(provider.Variable)
+	if password == "" {
+		return "", fmt.Errorf("Error reading password: environment variable %s is not set", provider.Variable)
+	}
+
+	return password, nil
+}
+
+func passwordGetCredential(environment *Environment, name string) (string, error) {
+	credentials, err := environment.Resolver().Credentials(name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, credential := range credentials {
+		if credential.Name == name {
+			if credential.Value == "" {
+				return "", fmt.Errorf("Error retrieving credential: %s: credential has no value", name)
+			}
+			return credential.Value, nil
+		}
+	}
+
+	return "", fmt.Errorf("Error retrieving credential: %s: no such credential", name)
+}
+
+func passwordExpand(text string, instance *Instance) (string, error) {
+	parsed, err := template.New("password").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing password template: %s: %s", text, err)
+	}
+
+	var expanded bytes.Buffer
+	err = parsed.Execute(&expanded, map[string]string{
+		"Name":        instance.Name,
+		"ResourceUid": instance.ResourceUid,
+		"Href":        instance.Href(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error expanding password template: %s: %s", text, err)
+	}
+
+	return expanded.String(), nil
+}
@@ -0,0 +1,172 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+var testingPasswordInstance = &Instance{
+	&cm15.Instance{
+		Links:       []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/ABC"}},
+		Name:        "web-1",
+		ResourceUid: "i-12345678",
+	},
+	&testingEnvironment,
+}
+
+func TestPasswordHelperProcess(t *testing.T) {
+	if os.Getenv("RSRDP_PASSWORD_HELPER") != "1" {
+		return
+	}
+	fmt.Printf("%s-password\nignored\n", os.Args[len(os.Args)-1])
+	os.Exit(0)
+}
+
+func TestPasswordConfigPasswordProvider(t *testing.T) {
+	RegisterTestingT(t)
+
+	provider, err := (&PasswordConfig{}).PasswordProvider()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(provider).To(BeAssignableToTypeOf(&RightScalePasswordProvider{}))
+
+	provider, err = (&PasswordConfig{Provider: "credential", Credential: "ADMIN_{{.Name}}"}).PasswordProvider()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(provider).To(Equal(&CredentialPasswordProvider{"ADMIN_{{.Name}}"}))
+
+	provider, err = (&PasswordConfig{Provider: "input"}).PasswordProvider()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(provider).To(Equal(&InputPasswordProvider{"ADMIN_PASSWORD"}))
+
+	provider, err = (&PasswordConfig{Provider: "input", Input: "WINDOWS_ADMIN_PASSWORD"}).PasswordProvider()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(provider).To(Equal(&InputPasswordProvider{"WINDOWS_ADMIN_PASSWORD"}))
+
+	_, err = (&PasswordConfig{Provider: "command"}).PasswordProvider()
+	Expect(err).To(MatchError("Error configuring password provider: command: no command"))
+
+	_, err = (&PasswordConfig{Provider: "vault"}).PasswordProvider()
+	Expect(err).To(MatchError("Error configuring password provider: unsupported provider: vault"))
+}
+
+func TestCommandPasswordProvider(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Setenv("RSRDP_PASSWORD_HELPER", "1")
+	defer os.Unsetenv("RSRDP_PASSWORD_HELPER")
+
+	provider := &CommandPasswordProvider{[]string{os.Args[0], "-test.run=TestPasswordHelperProcess", "--", "{{.Name}}"}}
+	password, err := provider.Password(testingPasswordInstance)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(password).To(Equal("web-1-password"))
+
+	terminalMutex.Lock()
+	done := make(chan string, 1)
+	go func() {
+		password, _ := provider.Password(testingPasswordInstance)
+		done <- password
+	}()
+	Consistently(done).ShouldNot(Receive())
+	terminalMutex.Unlock()
+	Eventually(done, "5s").Should(Receive(Equal("web-1-password")))
+}
+
+func TestInputPasswordProvider(t *testing.T) {
+	RegisterTestingT(t)
+
+	resolver := &testingResolver{credentials: []*cm15.Credential{
+		{Name: "WINDOWS_ADMIN_PASSWORD_OTHER", Value: "other-password"},
+		{Name: "WINDOWS_ADMIN_PASSWORD", Value: "credential-password"},
+		{Name: "EMPTY"},
+	}}
+	environment := testingEnvironment
+	environment.Password = PasswordConfig{Provider: "input", Input: "WINDOWS_ADMIN_PASSWORD"}
+	environment.resolver = resolver
+	instance := &Instance{
+		&cm15.Instance{
+			Links:         []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/ABC"}},
+			Name:          "web-1",
+			AdminPassword: "admin-password",
+		},
+		&environment,
+	}
+
+	for _, test := range []struct {
+		inputs   []*cm15.Input
+		password string
+		err      string
+	}{
+		{[]*cm15.Input{{Name: "WINDOWS_ADMIN_PASSWORD", Value: "cred:WINDOWS_ADMIN_PASSWORD"}}, "credential-password", ""},
+		{[]*cm15.Input{{Name: "OTHER", Value: "text:other"}, {Name: "WINDOWS_ADMIN_PASSWORD", Value: "text:p@ssw0rd"}}, "p@ssw0rd", ""},
+		{[]*cm15.Input{{Name: "WINDOWS_ADMIN_PASSWORD", Value: "text:"}}, "admin-password", ""},
+		{[]*cm15.Input{{Name: "WINDOWS_ADMIN_PASSWORD", Value: "env:ADMIN_PASSWORD"}}, "admin-password", ""},
+		{[]*cm15.Input{{Name: "OTHER", Value: "text:other"}}, "admin-password", ""},
+		{[]*cm15.Input{}, "admin-password", ""},
+		{[]*cm15.Input{{Name: "WINDOWS_ADMIN_PASSWORD", Value: "cred:MISSING"}}, "", "Error retrieving credential: MISSING: no such credential"},
+		{[]*cm15.Input{{Name: "WINDOWS_ADMIN_PASSWORD", Value: "cred:EMPTY"}}, "", "Error retrieving credential: EMPTY: credential has no value"},
+		{nil, "", "Error retrieving instance inputs: /api/clouds/1/instances/ABC/inputs: 404 Not Found"},
+	} {
+		resolver.inputs = map[string][]*cm15.Input{}
+		if test.inputs != nil {
+			resolver.inputs["/api/clouds/1/instances/ABC"] = test.inputs
+		}
+
+		password, err := instance.Password()
+		if test.err != "" {
+			Expect(err).To(MatchError(test.err))
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(password).To(Equal(test.password))
+		}
+	}
+}
+
+func TestEnvironmentPasswordProvider(t *testing.T) {
+	RegisterTestingT(t)
+
+	provider := &EnvironmentPasswordProvider{"RSRDP_TEST_PASSWORD"}
+	_, err := provider.Password(testingPasswordInstance)
+	Expect(err).To(MatchError("Error reading password: environment variable RSRDP_TEST_PASSWORD is not set"))
+
+	os.Setenv("RSRDP_TEST_PASSWORD", "p@ssw0rd")
+	defer os.Unsetenv("RSRDP_TEST_PASSWORD")
+	password, err := provider.Password(testingPasswordInstance)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(password).To(Equal("p@ssw0rd"))
+}
+
+func TestPasswordExpand(t *testing.T) {
+	RegisterTestingT(t)
+
+	expanded, err := passwordExpand("windows/{{.Name}}/{{.ResourceUid}}{{.Href}}", testingPasswordInstance)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(expanded).To(Equal("windows/web-1/i-12345678/api/clouds/1/instances/ABC"))
+
+	_, err = passwordExpand("{{.Missing}}", testingPasswordInstance)
+	Expect(err).To(HaveOccurred())
+}
@@ -26,40 +26,155 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/kardianos/osext"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+const (
+	rdpPort           = 3389
+	rdpStartup        = 2 * time.Second
+	rdpStatusInterval = 100 * time.Millisecond
+	rdpStatusTimeout  = 10 * time.Second
+)
+
+var (
+	remmina     = regexp.MustCompile("(?i)remmina")
+	freeRDP     = regexp.MustCompile("(?i)freerdp")
+	rdpSessions = &Sessions{processes: make(map[*os.Process]bool)}
 )
 
-var remmina = regexp.MustCompile("(?i)remmina")
+type Sessions struct {
+	mutex     sync.Mutex
+	processes map[*os.Process]bool
+}
+
+func (sessions *Sessions) Add(process *os.Process) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+	sessions.processes[process] = true
+}
+
+func (sessions *Sessions) Remove(process *os.Process) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+	delete(sessions.processes, process)
+}
+
+func (sessions *Sessions) Signal(signal os.Signal) {
+	sessions.mutex.Lock()
+	defer sessions.mutex.Unlock()
+	for process := range sessions.processes {
+		err := process.Signal(signal)
+		if err != nil {
+			log15.Warn("could not forward signal to Remote Desktop session", "pid", process.Pid, "signal", signal, "error", err)
+		}
+	}
+}
 
-func rdpLaunch(instance *Instance, private bool, index int, arguments []string, prompt bool, username string, timeout, interval time.Duration) error {
+func rdpLaunch(instance *Instance, private bool, index int, arguments []string, prompt bool, username string, open, wait bool, timeout, interval time.Duration) error {
 	err := instance.Wait(private, index, prompt, timeout, interval)
 	if err != nil {
 		return err
 	}
 
-	return rdpLaunchNative(instance, private, index, arguments, prompt, username)
+	username, domain, err := usernameForInstance(instance, username)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	if open {
+		err = rdpLaunchOpen(instance, private, index, arguments, prompt, username, domain, wait)
+	} else {
+		err = rdpLaunchNative(instance, private, index, arguments, prompt, username, domain, wait)
+	}
+	if wait {
+		log15.Info("Remote Desktop session ended", "instance", instance.Href(), "duration", time.Since(started))
+	}
+
+	return err
 }
 
-func rdpCreateFile(instance *Instance, private bool, index int, username string, password bool) (string, error) {
+func rdpLaunchOpen(instance *Instance, private bool, index int, arguments []string, prompt bool, username, domain string, wait bool) error {
+	opener, options, err := rdpFindOpenerNative()
+	if err != nil {
+		return err
+	}
+
 	ipAddress, err := instance.IpAddress(private, index)
 	if err != nil {
-		return "", err
+		return err
+	}
+
+	file, err := rdpCreateFile(instance, private, index, username, domain, false)
+	if err != nil {
+		return err
+	}
+
+	if !prompt {
+		fmt.Println(file, instance.AdminPassword)
+	}
+
+	return rdpRun(rdpOpenArgs(opener, options, arguments, file), nil, ipAddress, wait)
+}
+
+func rdpOpenArgs(opener string, options, arguments []string, file string) []string {
+	args := make([]string, 0, 9+len(options)+len(arguments))
+	args = append(args, "--temporary", filepath.Dir(file))
+	if !rdpOpenerWaits {
+		// rsrdp-run waits for the handler to read the file before it deletes the directory
+		args = append(args, "--handoff", "--shred", file)
+		if config.IsSet("client.shred_delay") {
+			args = append(args, "--shred-delay", config.GetString("client.shred_delay"))
+		}
+	}
+	args = append(args, "--", opener)
+	args = append(args, options...)
+	if rdpOpenerFileFirst {
+		args = append(args, file)
+	}
+	args = append(args, arguments...)
+	if !rdpOpenerFileFirst {
+		args = append(args, file)
+	}
+	return args
+}
+
+func rdpLaunchPrint(instance *Instance, private bool, index int, prompt bool, username, domain string) error {
+	file, err := rdpCreateFile(instance, private, index, username, domain, false)
+	if err != nil {
+		return err
+	}
+
+	if prompt {
+		fmt.Println(file)
+	} else {
+		fmt.Println(file, instance.AdminPassword)
 	}
 
-	dir, err := ioutil.TempDir("", "rsrdp")
+	return nil
+}
+
+func rdpCreateFile(instance *Instance, private bool, index int, username, domain string, password bool) (string, error) {
+	ipAddress, err := instance.IpAddress(private, index)
 	if err != nil {
-		return "", fmt.Errorf("Error creating RDP directory: %s", err)
+		return "", err
 	}
 
-	file, err := os.OpenFile(filepath.Join(dir, ipAddress+".rdp"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	file, err := rdpCreateTemporaryFile(ipAddress + ".rdp")
 	if err != nil {
-		return "", fmt.Errorf("Error creating RDP file: %s", err)
+		return "", err
 	}
 	defer func() {
 		err := file.Close()
@@ -68,22 +183,69 @@ func rdpCreateFile(instance *Instance, private bool, index int, username string,
 		}
 	}()
 
-	_, err = rdpWriteParameter(file, "full address", ipAddress)
+	err = rdpWriteFile(file, instance, ipAddress, username, domain, password)
 	if err != nil {
 		return "", err
 	}
-	_, err = rdpWriteParameter(file, "username", username)
+
+	return file.Name(), nil
+}
+
+func rdpTemporaryParent() string {
+	runtimeDir := os.Getenv("XDG_RUNTIME_DIR")
+	if runtimeDir != "" {
+		info, err := os.Stat(runtimeDir)
+		if err == nil && info.IsDir() {
+			return runtimeDir
+		}
+	}
+
+	return os.TempDir()
+}
+
+func rdpWriteFile(writer io.Writer, instance *Instance, ipAddress, username, domain string, password bool) error {
+	_, err := rdpWriteParameter(writer, "full address", ipAddress)
+	if err != nil {
+		return err
+	}
+	_, err = rdpWriteParameter(writer, "username", username)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if domain != "" {
+		_, err = rdpWriteParameter(writer, "domain", domain)
+		if err != nil {
+			return err
+		}
 	}
 	if password {
-		_, err = rdpWriteParameter(file, "password", instance.AdminPassword)
+		_, err = rdpWriteParameter(writer, "password", instance.AdminPassword)
 		if err != nil {
-			return "", err
+			return err
 		}
 	}
 
-	return file.Name(), nil
+	return nil
+}
+
+func rdpCreateTemporaryFile(name string) (*os.File, error) {
+	dir, err := ioutil.TempDir(rdpTemporaryParent(), "rsrdp")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating RDP directory: %s", err)
+	}
+
+	err = sweepMarkDir(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("Error creating RDP directory: %s", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating RDP file: %s", err)
+	}
+
+	return file, nil
 }
 
 func rdpWriteParameter(writer io.Writer, key string, value interface{}) (int, error) {
@@ -117,6 +279,129 @@ func rdpIsRemmina(client string) bool {
 	return remmina.MatchString(filepath.Base(client))
 }
 
+func rdpIsFreeRDP(client string) bool {
+	return freeRDP.MatchString(filepath.Base(client))
+}
+
+func rdpRun(args []string, stdin io.Reader, ipAddress string, wait bool) error {
+	executable, err := rdpFindRunExecutable()
+	if err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "rsrdp-status")
+	if err != nil {
+		return fmt.Errorf("Error creating status directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = sweepMarkDir(dir)
+	if err != nil {
+		return fmt.Errorf("Error creating status directory: %s", err)
+	}
+	status := filepath.Join(dir, "status")
+
+	runArgs := []string{"--status", status, "--startup", rdpStartup.String()}
+	if attempts := config.GetInt("client.reconnect.attempts"); attempts > 0 {
+		runArgs = append(runArgs, "--reconnect", strconv.Itoa(attempts), "--address", net.JoinHostPort(ipAddress, strconv.Itoa(rdpPort)))
+		if config.IsSet("client.reconnect.backoff") {
+			runArgs = append(runArgs, "--backoff", config.GetString("client.reconnect.backoff"))
+		}
+	}
+
+	command := exec.Command(executable, append(runArgs, args...)...)
+	command.Stdin = stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+
+	err = command.Start()
+	if err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- command.Wait()
+	}()
+
+	if wait {
+		rdpSessions.Add(command.Process)
+		defer rdpSessions.Remove(command.Process)
+	}
+
+	ticker := time.NewTicker(rdpStatusInterval)
+	defer ticker.Stop()
+	deadline := time.After(rdpStartup + rdpStatusTimeout)
+	for {
+		select {
+		case <-ticker.C:
+			ready, err := rdpReadStatus(status)
+			if !ready {
+				continue
+			}
+			if err != nil || !wait {
+				return err
+			}
+			ticker.Stop()
+		case err := <-exited:
+			ready, statusErr := rdpReadStatus(status)
+			if ready && statusErr != nil {
+				return statusErr
+			}
+			if err != nil {
+				return fmt.Errorf("Error running rsrdp-run: %s", err)
+			}
+			return nil
+		case <-deadline:
+			if !wait {
+				log15.Warn("timed out waiting for Remote Desktop client to start", "timeout", rdpStartup+rdpStatusTimeout)
+				return nil
+			}
+		}
+	}
+}
+
+func rdpForwardSignals(signals <-chan os.Signal) {
+	for signal := range signals {
+		log15.Info("forwarding signal to Remote Desktop sessions", "signal", signal)
+		rdpSessions.Signal(signal)
+	}
+}
+
+func rdpReadStatus(file string) (bool, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, nil
+	}
+
+	lines := strings.SplitN(string(content), "\n", 2)
+	var tail string
+	if len(lines) > 1 {
+		tail = strings.TrimSpace(lines[1])
+	}
+
+	switch {
+	case lines[0] == "started":
+		return true, nil
+	case strings.HasPrefix(lines[0], "exited "):
+		exitStatus, err := strconv.Atoi(strings.TrimPrefix(lines[0], "exited "))
+		if err != nil {
+			return true, fmt.Errorf("Error reading Remote Desktop client status: %s", err)
+		}
+		if exitStatus == 0 {
+			return true, nil
+		}
+		if tail == "" {
+			return true, fmt.Errorf("Remote Desktop client exited with status %d", exitStatus)
+		}
+		return true, fmt.Errorf("Remote Desktop client exited with status %d: %s", exitStatus, tail)
+	case strings.HasPrefix(lines[0], "error "):
+		return true, fmt.Errorf("Error running Remote Desktop client: %s", strings.TrimPrefix(lines[0], "error "))
+	default:
+		return true, fmt.Errorf("Error reading Remote Desktop client status: unknown status: %q", lines[0])
+	}
+}
+
 func rdpFindRunExecutable() (string, error) {
 	folder, err := osext.ExecutableFolder()
 	if err != nil {
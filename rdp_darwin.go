@@ -24,19 +24,26 @@ package main
 
 import (
 	"fmt"
+	"os/exec"
 )
 
-func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username string) error {
-	file, err := rdpCreateFile(instance, private, index, username, false)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(file, instance.AdminPassword)
+const (
+	rdpOpenerWaits     = true
+	rdpOpenerFileFirst = false
+)
 
-	return nil
+func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username, domain string, wait bool) error {
+	return rdpLaunchOpen(instance, private, index, arguments, prompt, username, domain, wait)
 }
 
 func rdpFindClientNative() (string, error) {
 	return "", nil
 }
+
+func rdpFindOpenerNative() (string, []string, error) {
+	_, err := exec.LookPath("open")
+	if err != nil {
+		return "", nil, fmt.Errorf("Error finding desktop default handler executable: %s", err)
+	}
+	return "open", []string{"-W"}, nil
+}
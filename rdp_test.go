@@ -0,0 +1,77 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+func TestRdpReadStatus(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp-status")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "status")
+
+	ready, err := rdpReadStatus(file)
+	Expect(ready).To(BeFalse())
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, test := range []struct {
+		content string
+		err     string
+	}{
+		{"started\n", ""},
+		{"exited 0\n", ""},
+		{"exited 131\nconnection refused\n", "Remote Desktop client exited with status 131: connection refused"},
+		{"error exec: \"xfreerdp\": executable file not found in $PATH\n", "Error running Remote Desktop client: exec: \"xfreerdp\": executable file not found in $PATH"},
+	} {
+		Expect(ioutil.WriteFile(file, []byte(test.content), 0600)).To(Succeed())
+
+		ready, err := rdpReadStatus(file)
+		Expect(ready).To(BeTrue())
+		if test.err != "" {
+			Expect(err).To(MatchError(test.err))
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+}
+
+func TestRdpWriteFileWithDomain(t *testing.T) {
+	RegisterTestingT(t)
+
+	instance := &Instance{&cm15.Instance{AdminPassword: "p@ssw0rd"}, &testingEnvironment}
+	var buffer bytes.Buffer
+	err := rdpWriteFile(&buffer, instance, "192.0.2.1", "alice", "CORP", false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(buffer.String()).To(Equal("full address:s:192.0.2.1\r\nusername:s:alice\r\ndomain:s:CORP\r\n"))
+}
@@ -26,42 +26,99 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+const (
+	// xdg-open returns as soon as it hands the file off, so rsrdp-run has to watch for the handler reading it
+	rdpOpenerWaits     = false
+	rdpOpenerFileFirst = false
 )
 
-func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username string) error {
+func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username, domain string, wait bool) error {
+	if !rdpHasDisplay() {
+		log15.Error("no X11 or Wayland display available (neither $DISPLAY nor $WAYLAND_DISPLAY is set), so a Remote Desktop client cannot be launched; writing an RDP file instead", "instance", instance.Href())
+		return rdpLaunchPrint(instance, private, index, prompt, username, domain)
+	}
+
 	client, options, err := rdpFindClient()
 	if err != nil {
-		return err
+		if config.IsSet("client.executable") {
+			return err
+		}
+		log15.Error("no Remote Desktop client found for the available display, so one cannot be launched; writing an RDP file instead", "instance", instance.Href(), "error", err)
+		return rdpLaunchPrint(instance, private, index, prompt, username, domain)
 	}
 
 	count := len(options) + len(arguments)
-	if rdpIsRemmina(client) {
+	switch {
+	case rdpIsRemmina(client):
 		count += 6
-	} else {
+	case rdpIsFreeRDP(client):
+		count += 5
+		if !prompt {
+			count++
+		}
+	default:
 		count += 5
 		if !prompt {
 			count += 2
 		}
+		if domain != "" {
+			count += 2
+		}
 	}
 	args := make([]string, 0, count)
 
-	if rdpIsRemmina(client) {
-		file, err := rdpCreateFile(instance, private, index, username, !prompt)
+	ipAddress, err := instance.IpAddress(private, index)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rdpIsRemmina(client):
+		keyring := !prompt && config.GetBool("client.keyring")
+		file, err := remminaCreateFile(instance, private, index, username, domain, !prompt, keyring)
 		if err != nil {
 			return err
 		}
-		args = append(args, "--temporary", filepath.Dir(file), "--", client, "-c", file)
-	} else {
-		ipAddress, err := instance.IpAddress(private, index)
-		if err != nil {
-			return err
+		if keyring {
+			item, err := keyringStoreRemminaPassword(file, instance.AdminPassword)
+			if err != nil {
+				if !config.GetBool("remmina.save") {
+					os.RemoveAll(filepath.Dir(file))
+				}
+				return err
+			}
+			if !config.GetBool("remmina.save") {
+				args = append(args, "--credential", item)
+			}
 		}
-
-		args = append(args, "--", client, "-u", username, ipAddress)
+		if !config.GetBool("remmina.save") {
+			args = append(args, "--temporary", filepath.Dir(file))
+			if !prompt && config.GetBool("client.shred") {
+				args = append(args, "--shred", file)
+				if config.IsSet("client.shred_delay") {
+					args = append(args, "--shred-delay", config.GetString("client.shred_delay"))
+				}
+			}
+		}
+		args = append(args, "--", client, "-c", file)
+	case rdpIsFreeRDP(client):
+		args = append(args, "--")
+		args = append(args, rdpFreeRDPArgs(client, ipAddress, username, domain, prompt)...)
+	default:
+		args = append(args, "--", client, "-u", username)
+		if domain != "" {
+			args = append(args, "-d", domain)
+		}
+		args = append(args, ipAddress)
 		if !prompt {
 			args = append(args, "-p", "-")
 		}
@@ -70,35 +127,36 @@ func rdpLaunchNative(instance *Instance, private bool, index int, arguments []st
 	args = append(args, options...)
 	args = append(args, arguments...)
 
-	executable, err := rdpFindRunExecutable()
-	if err != nil {
-		return err
-	}
-
-	command := exec.Command(executable, args...)
+	var stdin io.Reader
 	if !prompt && !rdpIsRemmina(client) {
-		command.Stdin = strings.NewReader(instance.AdminPassword)
+		stdin = strings.NewReader(instance.AdminPassword + "\n")
 	}
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
 
-	err = command.Start()
-	if err != nil {
-		return err
-	}
-
-	fmt.Println(command, command.Stdin)
+	return rdpRun(args, stdin, ipAddress, wait)
+}
 
-	err = command.Process.Release()
-	if err != nil {
-		return err
+func rdpFreeRDPArgs(client, ipAddress, username, domain string, prompt bool) []string {
+	// always pass /d: so that /from-stdin only reads the password, even with an empty domain
+	args := []string{client, "/v:" + ipAddress, "/u:" + username, "/d:" + domain}
+	if !prompt {
+		args = append(args, "/from-stdin:force")
 	}
+	return args
+}
 
-	return nil
+func rdpHasDisplay() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
 }
 
 func rdpFindClientNative() (string, error) {
-	executables := []string{"remmina", "rdesktop"}
+	executables := []string{"remmina"}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		executables = append(executables, "wlfreerdp")
+	}
+	if os.Getenv("DISPLAY") != "" {
+		executables = append(executables, "xfreerdp", "rdesktop")
+	}
+
 	for _, executable := range executables {
 		_, err := exec.LookPath(executable)
 		if err == nil {
@@ -107,3 +165,11 @@ func rdpFindClientNative() (string, error) {
 	}
 	return "", fmt.Errorf("Error finding Remote Desktop client executable: none of %q found in $PATH", executables)
 }
+
+func rdpFindOpenerNative() (string, []string, error) {
+	_, err := exec.LookPath("xdg-open")
+	if err != nil {
+		return "", nil, fmt.Errorf("Error finding desktop default handler executable: %s", err)
+	}
+	return "xdg-open", nil, nil
+}
@@ -0,0 +1,72 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// +build !darwin,!windows
+
+package main
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+)
+
+func TestRdpFreeRDPArgs(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(rdpFreeRDPArgs("xfreerdp", "10.0.0.1", "Administrator", "", false)).To(Equal([]string{"xfreerdp", "/v:10.0.0.1", "/u:Administrator", "/d:", "/from-stdin:force"}))
+	Expect(rdpFreeRDPArgs("wlfreerdp", "10.0.0.1", "alice", "CORP", false)).To(Equal([]string{"wlfreerdp", "/v:10.0.0.1", "/u:alice", "/d:CORP", "/from-stdin:force"}))
+	Expect(rdpFreeRDPArgs("xfreerdp", "10.0.0.1", "alice", "CORP", true)).To(Equal([]string{"xfreerdp", "/v:10.0.0.1", "/u:alice", "/d:CORP"}))
+}
+
+func TestRdpFindClientNativeWithWaylandOnly(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, variable := range []string{"DISPLAY", "WAYLAND_DISPLAY", "PATH"} {
+		if value, ok := os.LookupEnv(variable); ok {
+			defer os.Setenv(variable, value)
+		} else {
+			defer os.Unsetenv(variable)
+		}
+	}
+	os.Unsetenv("DISPLAY")
+	os.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	os.Setenv("PATH", "")
+
+	Expect(rdpHasDisplay()).To(BeTrue())
+	_, err := rdpFindClientNative()
+	Expect(err).To(MatchError("Error finding Remote Desktop client executable: none of [\"remmina\" \"wlfreerdp\"] found in $PATH"))
+}
+
+func TestRdpOpenArgs(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer func(previous Config) { config = previous }(config)
+	config = Config{Viper: viper.New()}
+
+	Expect(rdpOpenArgs("xdg-open", nil, []string{"--verbose"}, "/tmp/rsrdp123/10.0.0.1.rdp")).To(Equal([]string{"--temporary", "/tmp/rsrdp123", "--handoff", "--shred", "/tmp/rsrdp123/10.0.0.1.rdp", "--", "xdg-open", "--verbose", "/tmp/rsrdp123/10.0.0.1.rdp"}))
+
+	config.Set("client.shred_delay", "30s")
+	Expect(rdpOpenArgs("xdg-open", nil, nil, "/tmp/rsrdp123/10.0.0.1.rdp")).To(Equal([]string{"--temporary", "/tmp/rsrdp123", "--handoff", "--shred", "/tmp/rsrdp123/10.0.0.1.rdp", "--shred-delay", "30s", "--", "xdg-open", "/tmp/rsrdp123/10.0.0.1.rdp"}))
+}
@@ -24,14 +24,19 @@ package main
 
 import (
 	"fmt"
-	"os"
 	"os/exec"
 	"path/filepath"
 
 	"github.com/douglaswth/rsrdp/win32"
 )
 
-func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username string) error {
+const (
+	// start takes anything before the file as its own arguments
+	rdpOpenerWaits     = true
+	rdpOpenerFileFirst = true
+)
+
+func rdpLaunchNative(instance *Instance, private bool, index int, arguments []string, prompt bool, username, domain string, wait bool) error {
 	client, options, err := rdpFindClient()
 	if err != nil {
 		return err
@@ -43,19 +48,23 @@ func rdpLaunchNative(instance *Instance, private bool, index int, arguments []st
 	}
 	args := make([]string, 0, count)
 
+	ipAddress, err := instance.IpAddress(private, index)
+	if err != nil {
+		return err
+	}
+
 	if !prompt {
-		ipAddress, err := instance.IpAddress(private, index)
-		if err != nil {
-			return err
+		credentialUsername := username
+		if domain != "" {
+			credentialUsername = domain + "\\" + username
 		}
-
 		credential := win32.CREDENTIAL{
 			Type:           win32.CRED_TYPE_GENERIC,
 			TargetName:     ipAddress,
 			Comment:        "Temporary RSRDP credential",
 			CredentialBlob: instance.AdminPassword,
 			Persist:        win32.CRED_PERSIST_SESSION,
-			UserName:       username,
+			UserName:       credentialUsername,
 		}
 		err = win32.CredWrite(&credential, 0)
 		if err != nil {
@@ -64,7 +73,7 @@ func rdpLaunchNative(instance *Instance, private bool, index int, arguments []st
 		args = append(args, "--credential", ipAddress)
 	}
 
-	file, err := rdpCreateFile(instance, private, index, username, false)
+	file, err := rdpCreateFile(instance, private, index, username, domain, false)
 	if err != nil {
 		return err
 	}
@@ -72,25 +81,7 @@ func rdpLaunchNative(instance *Instance, private bool, index int, arguments []st
 	args = append(args, options...)
 	args = append(args, arguments...)
 
-	executable, err := rdpFindRunExecutable()
-	if err != nil {
-		return err
-	}
-
-	command := exec.Command(executable, args...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
-
-	err = command.Start()
-	if err != nil {
-		return err
-	}
-	err = command.Process.Release()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return rdpRun(args, nil, ipAddress, wait)
 }
 
 func rdpFindClientNative() (string, error) {
@@ -100,3 +91,11 @@ func rdpFindClientNative() (string, error) {
 	}
 	return "mstsc", nil
 }
+
+func rdpFindOpenerNative() (string, []string, error) {
+	_, err := exec.LookPath("cmd")
+	if err != nil {
+		return "", nil, fmt.Errorf("Error finding desktop default handler executable: %s", err)
+	}
+	return "cmd", []string{"/c", "start", "/wait", "rsrdp"}, nil
+}
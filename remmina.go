@@ -0,0 +1,290 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+type RemminaParameter struct {
+	Key   string
+	Value interface{}
+}
+
+func remminaCreateFile(instance *Instance, private bool, index int, username, domain string, password, keyring bool) (string, error) {
+	ipAddress, err := instance.IpAddress(private, index)
+	if err != nil {
+		return "", err
+	}
+
+	parameters, err := remminaProfileParameters(instance, ipAddress, username, domain, password, keyring)
+	if err != nil {
+		return "", err
+	}
+
+	var file *os.File
+	if config.GetBool("remmina.save") {
+		file, err = remminaCreateDataFile(instance, ipAddress)
+	} else {
+		file, err = rdpCreateTemporaryFile(ipAddress + ".remmina")
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	err = remminaWriteProfile(file, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+func remminaProfileParameters(instance *Instance, ipAddress, username, domain string, password, keyring bool) ([]RemminaParameter, error) {
+	name := instance.Name
+	if name == "" {
+		name = ipAddress
+	}
+
+	parameters := []RemminaParameter{
+		{"server", ipAddress},
+		{"name", name},
+		{"protocol", "RDP"},
+		{"username", username},
+	}
+	if domain != "" {
+		parameters = append(parameters, RemminaParameter{"domain", domain})
+	}
+
+	switch {
+	case password && keyring:
+		// Remmina looks up passwords stored as "." with its secret plugin
+		parameters = append(parameters, RemminaParameter{"password", "."})
+	case password:
+		encryptedPassword, err := remminaEncryptPasswordWithPref(instance.AdminPassword)
+		if err != nil {
+			log15.Warn("not storing password in Remmina profile", "instance", instance.Href(), "error", err)
+		} else {
+			parameters = append(parameters, RemminaParameter{"password", encryptedPassword})
+		}
+	}
+
+	deploymentName, err := instance.DeploymentName()
+	if err != nil {
+		log15.Warn("not grouping Remmina profile by deployment", "instance", instance.Href(), "error", err)
+	} else if deploymentName != "" {
+		parameters = append(parameters, RemminaParameter{"group", deploymentName})
+	}
+
+	if config.IsSet("remmina.resolution") {
+		var width, height int
+		resolution := config.GetString("remmina.resolution")
+		_, err := fmt.Sscanf(resolution, "%dx%d", &width, &height)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing Remmina resolution: %s: %s", resolution, err)
+		}
+		parameters = append(parameters, RemminaParameter{"resolution_mode", 2}, RemminaParameter{"resolution_width", width}, RemminaParameter{"resolution_height", height})
+	}
+	if config.IsSet("remmina.color_depth") {
+		parameters = append(parameters, RemminaParameter{"colordepth", config.GetInt("remmina.color_depth")})
+	}
+	if config.IsSet("remmina.share_folder") {
+		parameters = append(parameters, RemminaParameter{"sharefolder", config.GetString("remmina.share_folder")})
+	}
+	if config.IsSet("remmina.gateway.server") {
+		parameters = append(parameters, RemminaParameter{"gateway_server", config.GetString("remmina.gateway.server")})
+		if config.IsSet("remmina.gateway.username") {
+			parameters = append(parameters, RemminaParameter{"gateway_username", config.GetString("remmina.gateway.username")})
+		}
+		if config.IsSet("remmina.gateway.domain") {
+			parameters = append(parameters, RemminaParameter{"gateway_domain", config.GetString("remmina.gateway.domain")})
+		}
+	}
+
+	return parameters, nil
+}
+
+func remminaCreateDataFile(instance *Instance, ipAddress string) (*os.File, error) {
+	dir, err := remminaDataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Remmina data directory: %s", err)
+	}
+
+	id := instance.ResourceUid
+	if id == "" {
+		id = ipAddress
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, "rsrdp-"+id+".remmina"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Remmina profile: %s", err)
+	}
+
+	return file, nil
+}
+
+func remminaDataDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("Error finding Remmina data directory: %s", err)
+		}
+		dataHome = filepath.Join(currentUser.HomeDir, ".local", "share")
+	}
+
+	return filepath.Join(dataHome, "remmina"), nil
+}
+
+func remminaWriteProfile(writer io.Writer, parameters []RemminaParameter) error {
+	_, err := fmt.Fprint(writer, "[remmina]\n")
+	if err != nil {
+		return err
+	}
+
+	for _, parameter := range parameters {
+		_, err = remminaWriteParameter(writer, parameter.Key, parameter.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func remminaWriteParameter(writer io.Writer, key string, value interface{}) (int, error) {
+	return fmt.Fprintf(writer, "%s=%v\n", key, value)
+}
+
+func remminaEncryptPasswordWithPref(password string) (string, error) {
+	prefFile, err := remminaFindPrefFile()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := remminaReadSecret(prefFile)
+	if err != nil {
+		return "", err
+	}
+
+	return remminaEncryptPassword(secret, password)
+}
+
+func remminaFindPrefFile() (string, error) {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Error finding Remmina preferences: %s", err)
+	}
+
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(currentUser.HomeDir, ".config")
+	}
+
+	prefFiles := []string{
+		filepath.Join(configHome, "remmina", "remmina.pref"),
+		filepath.Join(currentUser.HomeDir, ".remmina", "remmina.pref"),
+	}
+	for _, prefFile := range prefFiles {
+		_, err := os.Stat(prefFile)
+		if err == nil {
+			return prefFile, nil
+		}
+	}
+
+	return "", fmt.Errorf("Error finding Remmina preferences: none of %q found", prefFiles)
+}
+
+func remminaReadSecret(prefFile string) ([]byte, error) {
+	file, err := os.Open(prefFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Remmina preferences: %s", err)
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = line[1 : len(line)-1]
+			continue
+		}
+		if section != "remmina_pref" || !strings.HasPrefix(line, "secret=") {
+			continue
+		}
+
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "secret="))
+		if err != nil {
+			return nil, fmt.Errorf("%s: Error decoding Remmina secret: %s", prefFile, err)
+		}
+		if len(secret) < des.BlockSize*4 {
+			return nil, fmt.Errorf("%s: Remmina secret too short: %d bytes", prefFile, len(secret))
+		}
+		return secret, nil
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading Remmina preferences: %s", err)
+	}
+
+	return nil, fmt.Errorf("%s: could not find Remmina secret", prefFile)
+}
+
+// Remmina uses the first 24 bytes of its secret as a 3DES key and the next 8 bytes as the CBC IV
+func remminaEncryptPassword(secret []byte, password string) (string, error) {
+	block, err := des.NewTripleDESCipher(secret[:des.BlockSize*3])
+	if err != nil {
+		return "", fmt.Errorf("Error encrypting Remmina password: %s", err)
+	}
+
+	plaintext := make([]byte, (len(password)/des.BlockSize+1)*des.BlockSize)
+	copy(plaintext, password)
+
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, secret[des.BlockSize*3:des.BlockSize*4]).CryptBlocks(ciphertext, plaintext)
+
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
@@ -0,0 +1,112 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+var (
+	exampleRemminaPrefFile       = "test/example.remmina.pref"
+	missingSecretRemminaPrefFile = "test/missing_secret.remmina.pref"
+	nonexistentRemminaPrefFile   = "nonexistent/remmina.pref"
+)
+
+func TestRemminaReadSecretWithNonexistentFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	_, err := remminaReadSecret(nonexistentRemminaPrefFile)
+	Expect(err).To(HaveOccurred())
+}
+
+func TestRemminaReadSecretWithMissingSecret(t *testing.T) {
+	RegisterTestingT(t)
+
+	_, err := remminaReadSecret(missingSecretRemminaPrefFile)
+	Expect(err).To(MatchError(missingSecretRemminaPrefFile + ": could not find Remmina secret"))
+}
+
+func TestRemminaReadSecretWithExample(t *testing.T) {
+	RegisterTestingT(t)
+
+	secret, err := remminaReadSecret(exampleRemminaPrefFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(base64.StdEncoding.EncodeToString(secret)).To(Equal("AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA="))
+}
+
+func TestRemminaEncryptPassword(t *testing.T) {
+	RegisterTestingT(t)
+
+	secret, err := remminaReadSecret(exampleRemminaPrefFile)
+	Expect(err).NotTo(HaveOccurred())
+
+	password, err := remminaEncryptPassword(secret, "Pa$$w0rd!")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(password).To(Equal("VAT2HF9Ijh5j8XoogygT5w=="))
+
+	password, err = remminaEncryptPassword(secret, "abcdefgh")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(password).To(Equal("HelFBrEBB17Xppaywd3mqQ=="))
+}
+
+func TestRemminaProfileParametersWithExample(t *testing.T) {
+	RegisterTestingT(t)
+
+	err := readConfig(exampleConfigFile, "")
+	Expect(err).NotTo(HaveOccurred())
+
+	instance := &Instance{&cm15.Instance{Name: "Windows Server"}, &testingEnvironment}
+	parameters, err := remminaProfileParameters(instance, "192.0.2.1", "Administrator", "", false, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(parameters).To(Equal([]RemminaParameter{
+		{"server", "192.0.2.1"},
+		{"name", "Windows Server"},
+		{"protocol", "RDP"},
+		{"username", "Administrator"},
+		{"resolution_mode", 2},
+		{"resolution_width", 1280},
+		{"resolution_height", 800},
+		{"colordepth", 32},
+		{"sharefolder", "/home/user/Shared"},
+		{"gateway_server", "gateway.example.com"},
+		{"gateway_username", "gateway"},
+	}))
+}
+
+func TestRemminaWriteProfile(t *testing.T) {
+	RegisterTestingT(t)
+
+	var buffer bytes.Buffer
+	err := remminaWriteProfile(&buffer, []RemminaParameter{
+		{"server", "192.0.2.1"},
+		{"protocol", "RDP"},
+		{"colordepth", 32},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(buffer.String()).To(Equal("[remmina]\nserver=192.0.2.1\nprotocol=RDP\ncolordepth=32\n"))
+}
@@ -0,0 +1,211 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/rightscale/rsc.v4/cm15"
+	"gopkg.in/rightscale/rsc.v4/rsapi"
+)
+
+// Resolver looks up the RightScale resources rsrdp needs for an environment.
+type Resolver interface {
+	Instance(href string, sensitive bool) (*cm15.Instance, error)
+	Instances(href string, sensitive bool) ([]*cm15.Instance, error)
+	Servers() ([]*cm15.Server, error)
+	ServerArrays() ([]*cm15.ServerArray, error)
+	Server(href string) (*cm15.Server, error)
+	ServerArray(href string) (*cm15.ServerArray, error)
+	Deployment(href string) (*cm15.Deployment, error)
+	Tags(href string) ([]string, error)
+	Inputs(instanceHref string) ([]*cm15.Input, error)
+	Credentials(name string) ([]*cm15.Credential, error)
+}
+
+type apiResolver struct {
+	environment *Environment
+}
+
+func (environment *Environment) Resolver() Resolver {
+	if environment.resolver != nil {
+		return environment.resolver
+	}
+	return &apiResolver{environment}
+}
+
+func (resolver *apiResolver) Instance(href string, sensitive bool) (*cm15.Instance, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	params := rsapi.APIParams{}
+	if sensitive {
+		params["view"] = "sensitive"
+	}
+	instance, err := client15.InstanceLocator(href).Show(params)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving instance: %s: %s", href, err)
+	}
+
+	return instance, nil
+}
+
+func (resolver *apiResolver) Instances(href string, sensitive bool) ([]*cm15.Instance, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	params := rsapi.APIParams{}
+	if sensitive {
+		params["view"] = "sensitive"
+	}
+	instances, err := client15.InstanceLocator(href).Index(params)
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving array instances: %s: %s", href, err)
+	}
+
+	return instances, nil
+}
+
+func (resolver *apiResolver) Servers() ([]*cm15.Server, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := client15.ServerLocator("/api/servers").Index(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving servers: %s", err)
+	}
+
+	return servers, nil
+}
+
+func (resolver *apiResolver) ServerArrays() ([]*cm15.ServerArray, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	arrays, err := client15.ServerArrayLocator("/api/server_arrays").Index(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving arrays: %s", err)
+	}
+
+	return arrays, nil
+}
+
+func (resolver *apiResolver) Server(href string) (*cm15.Server, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	server, err := client15.ServerLocator(href).Show(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving server: %s: %s", href, err)
+	}
+
+	return server, nil
+}
+
+func (resolver *apiResolver) ServerArray(href string) (*cm15.ServerArray, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	array, err := client15.ServerArrayLocator(href).Show(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving array: %s: %s", href, err)
+	}
+
+	return array, nil
+}
+
+func (resolver *apiResolver) Deployment(href string) (*cm15.Deployment, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	deployment, err := client15.DeploymentLocator(href).Show(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving deployment: %s: %s", href, err)
+	}
+
+	return deployment, nil
+}
+
+func (resolver *apiResolver) Tags(href string) ([]string, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	resourceTags, err := client15.TagLocator("/api/tags/by_resource").ByResource([]string{href})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving tags: %s: %s", href, err)
+	}
+
+	var tags []string
+	for _, resourceTag := range resourceTags {
+		for _, tag := range resourceTag.Tags {
+			tags = append(tags, tag["name"])
+		}
+	}
+
+	return tags, nil
+}
+
+func (resolver *apiResolver) Inputs(instanceHref string) ([]*cm15.Input, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	inputsHref := instanceHref + "/inputs"
+	inputs, err := client15.InputLocator(inputsHref).Index(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving instance inputs: %s: %s", inputsHref, err)
+	}
+
+	return inputs, nil
+}
+
+func (resolver *apiResolver) Credentials(name string) ([]*cm15.Credential, error) {
+	client15, err := resolver.environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := client15.CredentialLocator("/api/credentials").Index(rsapi.APIParams{"filter": []string{"name==" + name}, "view": "sensitive"})
+	if err != nil {
+		return nil, fmt.Errorf("Error retrieving credential: %s: %s", name, err)
+	}
+
+	return credentials, nil
+}
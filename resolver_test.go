@@ -0,0 +1,124 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+// testingResolver answers API lookups from canned resources.
+type testingResolver struct {
+	instances   map[string]*cm15.Instance
+	sensitive   map[string]int
+	current     map[string][]string
+	serverList  []*cm15.Server
+	arrayList   []*cm15.ServerArray
+	servers     map[string]*cm15.Server
+	arrays      map[string]*cm15.ServerArray
+	deployments map[string]*cm15.Deployment
+	tags        map[string][]string
+	inputs      map[string][]*cm15.Input
+	credentials []*cm15.Credential
+}
+
+func (resolver *testingResolver) Instance(href string, sensitive bool) (*cm15.Instance, error) {
+	instance, ok := resolver.instances[href]
+	if !ok {
+		return nil, fmt.Errorf("Error retrieving instance: %s: 404 Not Found", href)
+	}
+	shown := *instance
+	if sensitive {
+		if resolver.sensitive == nil {
+			resolver.sensitive = make(map[string]int)
+		}
+		resolver.sensitive[href]++
+	} else {
+		shown.AdminPassword = ""
+	}
+	return &shown, nil
+}
+
+func (resolver *testingResolver) Instances(href string, sensitive bool) ([]*cm15.Instance, error) {
+	var instances []*cm15.Instance
+	for _, instanceHref := range resolver.current[href] {
+		instance, err := resolver.Instance(instanceHref, sensitive)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+	return instances, nil
+}
+
+func (resolver *testingResolver) Servers() ([]*cm15.Server, error) {
+	if resolver.serverList == nil {
+		return nil, fmt.Errorf("Error retrieving servers: 403 Forbidden")
+	}
+	return resolver.serverList, nil
+}
+
+func (resolver *testingResolver) ServerArrays() ([]*cm15.ServerArray, error) {
+	return resolver.arrayList, nil
+}
+
+func (resolver *testingResolver) Server(href string) (*cm15.Server, error) {
+	server, ok := resolver.servers[href]
+	if !ok {
+		return nil, fmt.Errorf("Error retrieving server: %s: 404 Not Found", href)
+	}
+	return server, nil
+}
+
+func (resolver *testingResolver) ServerArray(href string) (*cm15.ServerArray, error) {
+	array, ok := resolver.arrays[href]
+	if !ok {
+		return nil, fmt.Errorf("Error retrieving array: %s: 404 Not Found", href)
+	}
+	return array, nil
+}
+
+func (resolver *testingResolver) Deployment(href string) (*cm15.Deployment, error) {
+	deployment, ok := resolver.deployments[href]
+	if !ok {
+		return nil, fmt.Errorf("Error retrieving deployment: %s: 404 Not Found", href)
+	}
+	return deployment, nil
+}
+
+func (resolver *testingResolver) Tags(href string) ([]string, error) {
+	return resolver.tags[href], nil
+}
+
+func (resolver *testingResolver) Inputs(instanceHref string) ([]*cm15.Input, error) {
+	inputs, ok := resolver.inputs[instanceHref]
+	if !ok {
+		return nil, fmt.Errorf("Error retrieving instance inputs: %s/inputs: 404 Not Found", instanceHref)
+	}
+	return inputs, nil
+}
+
+func (resolver *testingResolver) Credentials(name string) ([]*cm15.Credential, error) {
+	return resolver.credentials, nil
+}
@@ -23,6 +23,23 @@
 
 package main
 
+import (
+	"github.com/godbus/dbus"
+
+	"github.com/douglaswth/rsrdp/secretservice"
+)
+
 func deleteCredential(credential string) error {
-	return nil
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+
+	service, err := secretservice.New(conn)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+
+	return service.DeleteItem(dbus.ObjectPath(credential))
 }
@@ -22,10 +22,17 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -33,10 +40,28 @@ import (
 var (
 	credential = kingpin.Flag("credential", "Temporary RSRDP credential to delete when finished").String()
 	temporary  = kingpin.Flag("temporary", "Temporary RDP file or directory to delete when finished").String()
+	status     = kingpin.Flag("status", "File to report whether the Windows Remote Desktop client started successfully to").String()
+	startup    = kingpin.Flag("startup", "The amount of time the Windows Remote Desktop client has to keep running to be considered started successfully").Default("2s").Duration()
+	reconnect  = kingpin.Flag("reconnect", "Maximum number of times to restart the Windows Remote Desktop client when it exits unsuccessfully (standard input is buffered so it can be replayed)").Int()
+	backoff    = kingpin.Flag("backoff", "The amount of time to wait before the first reconnect attempt (doubled for each further attempt)").Default("5s").Duration()
+	address    = kingpin.Flag("address", "Host and port to check for reachability before each reconnect attempt").String()
+	shredFile  = kingpin.Flag("shred", "Password-bearing file to overwrite and delete as soon as the Windows Remote Desktop client has read it").String()
+	shredDelay = kingpin.Flag("shred-delay", "The amount of time to wait before shredding instead of watching for the Windows Remote Desktop client to read the file").Duration()
+	handoff    = kingpin.Flag("handoff", "The executable hands the file given to --shred off to another program and exits, so wait for that program to read it before cleaning up").Bool()
 	executable = kingpin.Arg("executable", "Windows Remote Desktop client executable").Required().String()
 	arguments  = kingpin.Arg("arguments", "Arguments to Windows Remote Desktop client").Required().Strings()
 )
 
+const (
+	pidFile     = "rsrdp-run.pid"
+	maxBackoff  = time.Minute
+	dialTimeout = 5 * time.Second
+	killTimeout = 10 * time.Second
+
+	defaultShredDelay = 10 * time.Second
+	handoffTimeout    = time.Minute
+)
+
 type Cleanup struct {
 	Execute func() error
 	Message string
@@ -45,17 +70,127 @@ type Cleanup struct {
 func main() {
 	kingpin.Parse()
 
-	command := exec.Command(*executable, *arguments...)
-	command.Stdout = os.Stdout
-	command.Stderr = os.Stderr
+	defer func() {
+		if r := recover(); r != nil {
+			cleanup()
+			panic(r)
+		}
+	}()
+
+	err := writePidFile()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Error writing PID file: %s\n", filepath.Base(os.Args[0]), err)
+	}
+
+	var input []byte
+	if *reconnect > 0 {
+		input, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error reading standard input: %s\n", filepath.Base(os.Args[0]), err)
+			cleanup()
+			os.Exit(1)
+		}
+	}
+	stdin := func() io.Reader {
+		if *reconnect > 0 {
+			return bytes.NewReader(input)
+		}
+		return os.Stdin
+	}
+
+	started := make(chan struct{})
+	var shredContent []byte
+	var shredded <-chan struct{}
+	if *shredFile != "" {
+		shredContent, err = ioutil.ReadFile(*shredFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error reading %s: %s\n", filepath.Base(os.Args[0]), *shredFile, err)
+			*shredFile = ""
+		} else {
+			shredded = armShred(started)
+		}
+	}
+
+	session := &Session{}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go forwardSignals(signals, session)
 
 	errs := false
-	err := command.Run()
+	exitCode := 0
+	err = run(session, stdin(), *status, started)
+	for attempt := 1; attempt <= *reconnect && err != nil && !session.Stopped() && shouldReconnect(err, started); attempt++ {
+		wait := reconnectBackoff(*backoff, attempt)
+		fmt.Fprintf(os.Stderr, "%s: %s exited unsuccessfully (%s), reconnecting in %s (attempt %d of %d)\n", filepath.Base(os.Args[0]), *executable, err, wait, attempt, *reconnect)
+		if !session.Sleep(wait) {
+			break
+		}
+
+		if *address != "" {
+			addressErr := checkAddress(*address)
+			if addressErr != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s is not reachable: %s\n", filepath.Base(os.Args[0]), *address, addressErr)
+				continue
+			}
+		}
+
+		started = make(chan struct{})
+		if *shredFile != "" {
+			restoreErr := ioutil.WriteFile(*shredFile, shredContent, 0600)
+			if restoreErr != nil {
+				fmt.Fprintf(os.Stderr, "%s: Error restoring %s: %s\n", filepath.Base(os.Args[0]), *shredFile, restoreErr)
+			} else {
+				shredded = armShred(started)
+			}
+		}
+
+		err = run(session, stdin(), "", started)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s: Error running %s: %s\n", filepath.Base(os.Args[0]), *executable, err)
+		if _, ok := err.(*exec.ExitError); ok {
+			exitCode = exitStatus(err)
+		} else {
+			errs = true
+		}
+	}
+
+	if *handoff && err == nil && shredded != nil {
+		select {
+		case <-shredded:
+		case <-time.After(handoffTimeout):
+			fmt.Fprintf(os.Stderr, "%s: Timed out waiting for %s to be read\n", filepath.Base(os.Args[0]), *shredFile)
+		}
+	}
+
+	if !cleanup() {
 		errs = true
 	}
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
+	if errs {
+		os.Exit(1)
+	}
+}
 
+func shouldReconnect(err error, started <-chan struct{}) bool {
+	if _, ok := err.(*exec.ExitError); !ok {
+		return false
+	}
+
+	select {
+	case <-started:
+		// the session was up, so the connection dropped
+		return true
+	default:
+	}
+
+	// failing during startup is usually rejected arguments or credentials, which would only fail again, unless the host went away
+	return *address != "" && checkAddress(*address) != nil
+}
+
+func cleanup() bool {
 	cleanups := make([]Cleanup, 0, 2)
 	if *temporary != "" {
 		cleanups = append(cleanups, Cleanup{func() error {
@@ -76,14 +211,116 @@ func main() {
 		}(index, cleanup)
 	}
 
+	ok := true
 	for index, cleanup := range cleanups {
-		err = <-errChans[index]
+		err := <-errChans[index]
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", filepath.Base(os.Args[0]), cleanup.Message, err)
-			errs = true
+			ok = false
 		}
 	}
-	if errs {
-		os.Exit(1)
+
+	return ok
+}
+
+func armShred(started <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	if *handoff {
+		// the program the file is handed off to reads it after the executable exits, so there is no start to wait for
+		started = nil
+	}
+
+	shredded, err := shredAfterRead(*shredFile, *shredDelay, started)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Error watching %s: %s\n", filepath.Base(os.Args[0]), *shredFile, err)
+		close(done)
+		return done
+	}
+
+	go func() {
+		err := <-shredded
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error shredding %s: %s\n", filepath.Base(os.Args[0]), *shredFile, err)
+		}
+		close(done)
+	}()
+
+	return done
+}
+
+func writePidFile() error {
+	// mark the temporary and status directories as in use so rsrdp does not sweep them
+	dirs := make([]string, 0, 2)
+	if *temporary != "" {
+		dirs = append(dirs, *temporary)
+	}
+	if *status != "" {
+		dirs = append(dirs, filepath.Dir(*status))
+	}
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s: not a directory", dir)
+		}
+
+		err = ioutil.WriteFile(filepath.Join(dir, pidFile), []byte(strconv.Itoa(os.Getpid())), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func run(session *Session, stdin io.Reader, status string, started chan<- struct{}) error {
+	tail := &Tail{}
+	command := exec.Command(*executable, *arguments...)
+	command.Stdin = stdin
+	command.Stdout = os.Stdout
+	command.Stderr = io.MultiWriter(tail, os.Stderr)
+
+	err := session.Start(command)
+	if err != nil {
+		reportStatus(writeExitedStatus(status, err, tail))
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+
+	select {
+	case err = <-done:
+		reportStatus(writeExitedStatus(status, err, tail))
+	case <-time.After(*startup):
+		close(started)
+		reportStatus(writeStartedStatus(status))
+		err = <-done
+	}
+
+	return err
+}
+
+func forwardSignals(signals <-chan os.Signal, session *Session) {
+	var kill *time.Timer
+	for signal := range signals {
+		err := session.Signal(signal)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: Error forwarding signal %s: %s\n", filepath.Base(os.Args[0]), signal, err)
+		}
+		if kill == nil {
+			kill = time.AfterFunc(killTimeout, session.Kill)
+		}
+	}
+}
+
+func reportStatus(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: Error writing status: %s\n", filepath.Base(os.Args[0]), err)
 	}
 }
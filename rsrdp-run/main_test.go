@@ -0,0 +1,70 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWritePidFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	defer func(previousTemporary, previousStatus string) {
+		*temporary, *status = previousTemporary, previousStatus
+	}(*temporary, *status)
+	*temporary, *status = dir, ""
+
+	Expect(writePidFile()).To(Succeed())
+	content, err := ioutil.ReadFile(filepath.Join(dir, pidFile))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(Equal(strconv.Itoa(os.Getpid())))
+}
+
+func TestWritePidFileWithFile(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "10.0.0.1.rdp")
+	Expect(ioutil.WriteFile(file, []byte("full address:s:10.0.0.1\n"), 0600)).To(Succeed())
+
+	defer func(previousTemporary, previousStatus string) {
+		*temporary, *status = previousTemporary, previousStatus
+	}(*temporary, *status)
+	*temporary, *status = file, ""
+
+	Expect(writePidFile()).To(MatchError(file + ": not a directory"))
+	Expect(filepath.Join(dir, pidFile)).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,127 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+type Session struct {
+	mutex   sync.Mutex
+	process *os.Process
+	stopped bool
+	stop    chan struct{}
+}
+
+func (session *Session) Start(command *exec.Cmd) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.stopped {
+		return fmt.Errorf("session stopped")
+	}
+
+	err := command.Start()
+	if err != nil {
+		return err
+	}
+	session.process = command.Process
+
+	return nil
+}
+
+func (session *Session) Signal(signal os.Signal) error {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if !session.stopped {
+		session.stopped = true
+		close(session.stopChan())
+	}
+	if session.process == nil {
+		return nil
+	}
+	return session.process.Signal(signal)
+}
+
+func (session *Session) Kill() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.process != nil {
+		session.process.Kill()
+	}
+}
+
+func (session *Session) Stopped() bool {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	return session.stopped
+}
+
+// Sleep waits for duration and reports whether the session is still running, returning early when it is stopped
+func (session *Session) Sleep(duration time.Duration) bool {
+	session.mutex.Lock()
+	stop := session.stopChan()
+	session.mutex.Unlock()
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return !session.Stopped()
+	case <-stop:
+		return false
+	}
+}
+
+func (session *Session) stopChan() chan struct{} {
+	if session.stop == nil {
+		session.stop = make(chan struct{})
+	}
+	return session.stop
+}
+
+func reconnectBackoff(backoff time.Duration, attempt int) time.Duration {
+	for ; attempt > 1 && backoff < maxBackoff; attempt-- {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+	return backoff
+}
+
+func checkAddress(address string) error {
+	connection, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return err
+	}
+	return connection.Close()
+}
@@ -0,0 +1,87 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReconnectBackoff(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(reconnectBackoff(5*time.Second, 1)).To(Equal(5 * time.Second))
+	Expect(reconnectBackoff(5*time.Second, 2)).To(Equal(10 * time.Second))
+	Expect(reconnectBackoff(5*time.Second, 3)).To(Equal(20 * time.Second))
+	Expect(reconnectBackoff(5*time.Second, 5)).To(Equal(time.Minute))
+	Expect(reconnectBackoff(5*time.Second, 100)).To(Equal(time.Minute))
+}
+
+func TestSessionSignalBeforeStart(t *testing.T) {
+	RegisterTestingT(t)
+
+	session := &Session{}
+	Expect(session.Stopped()).To(BeFalse())
+	Expect(session.Signal(nil)).To(Succeed())
+	Expect(session.Stopped()).To(BeTrue())
+}
+
+func TestSessionSleep(t *testing.T) {
+	RegisterTestingT(t)
+
+	session := &Session{}
+	Expect(session.Sleep(time.Millisecond)).To(BeTrue())
+
+	woken := make(chan bool, 1)
+	go func() {
+		woken <- session.Sleep(time.Minute)
+	}()
+	Consistently(woken).ShouldNot(Receive())
+	Expect(session.Signal(nil)).To(Succeed())
+	Eventually(woken).Should(Receive(BeFalse()))
+
+	Expect(session.Sleep(time.Minute)).To(BeFalse())
+}
+
+func TestShouldReconnect(t *testing.T) {
+	RegisterTestingT(t)
+
+	exitErr := exec.Command("false").Run()
+	Expect(exitErr).To(BeAssignableToTypeOf(&exec.ExitError{}))
+
+	started := make(chan struct{})
+	Expect(shouldReconnect(errors.New("exec: not found"), started)).To(BeFalse())
+	Expect(shouldReconnect(exitErr, started)).To(BeFalse())
+
+	defer func(previous string) { *address = previous }(*address)
+	*address = "127.0.0.1:1"
+	Expect(shouldReconnect(exitErr, started)).To(BeTrue())
+	*address = ""
+
+	close(started)
+	Expect(shouldReconnect(exitErr, started)).To(BeTrue())
+}
@@ -0,0 +1,93 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// shredAfterRead shreds file once the client has read it (or after delay) and, unless started is nil, has started
+func shredAfterRead(file string, delay time.Duration, started <-chan struct{}) (<-chan error, error) {
+	var opened <-chan struct{}
+	var stop func()
+	if delay == 0 {
+		var err error
+		opened, stop, err = watchRead(file)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opened == nil {
+		if delay == 0 {
+			delay = defaultShredDelay
+		}
+		timer := make(chan struct{})
+		time.AfterFunc(delay, func() {
+			close(timer)
+		})
+		opened = timer
+	}
+
+	shredded := make(chan error, 1)
+	go func() {
+		<-opened
+		if stop != nil {
+			stop()
+		}
+		if started != nil {
+			<-started
+		}
+		shredded <- shred(file)
+	}()
+
+	return shredded, nil
+}
+
+func shred(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	handle, err := os.OpenFile(file, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = handle.Write(make([]byte, info.Size()))
+	if err == nil {
+		err = handle.Sync()
+	}
+	closeErr := handle.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Remove(file)
+}
@@ -0,0 +1,91 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// how long reads have to stop before the file counts as read, so a hand off between processes is not cut short
+var shredSettle = 2 * time.Second
+
+func watchRead(file string) (<-chan struct{}, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	_, err = syscall.InotifyAddWatch(fd, file, syscall.IN_CLOSE_NOWRITE|syscall.IN_DELETE_SELF)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	opened := make(chan struct{})
+	var once sync.Once
+	read := func() {
+		once.Do(func() {
+			close(opened)
+		})
+	}
+
+	go func() {
+		var settle *time.Timer
+		buffer := make([]byte, syscall.SizeofInotifyEvent*16+syscall.NAME_MAX+1)
+		for {
+			n, err := syscall.Read(fd, buffer)
+			if err == syscall.EINTR || err == syscall.EAGAIN {
+				continue
+			}
+			if err != nil {
+				// a read error is not a read; fall back to shredding after the default delay unless the watch was stopped
+				if err != syscall.EBADF {
+					time.AfterFunc(defaultShredDelay, read)
+				}
+				return
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+				switch {
+				case event.Mask&syscall.IN_DELETE_SELF != 0:
+					read()
+					return
+				case event.Mask&syscall.IN_CLOSE_NOWRITE != 0:
+					if settle == nil {
+						settle = time.AfterFunc(shredSettle, read)
+					} else {
+						settle.Reset(shredSettle)
+					}
+				}
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+			}
+		}
+	}()
+
+	return opened, func() { syscall.Close(fd) }, nil
+}
@@ -0,0 +1,91 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestShredAfterReadWithWatch(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer func(previous time.Duration) { shredSettle = previous }(shredSettle)
+	shredSettle = 200 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "rsrdp-run")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "192.0.2.1.remmina")
+	Expect(ioutil.WriteFile(file, []byte("password=secret\n"), 0600)).To(Succeed())
+
+	shredded, err := shredAfterRead(file, 0, nil)
+	Expect(err).NotTo(HaveOccurred())
+	Consistently(shredded).ShouldNot(Receive())
+	Expect(file).To(BeAnExistingFile())
+
+	// reads keep postponing the shred until they settle
+	for read := 0; read < 3; read++ {
+		content, err := ioutil.ReadFile(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(Equal("password=secret\n"))
+		time.Sleep(shredSettle / 2)
+	}
+	Expect(file).To(BeAnExistingFile())
+
+	Eventually(shredded).Should(Receive(BeNil()))
+	Expect(file).NotTo(BeAnExistingFile())
+}
+
+func TestShredAfterReadWithWatchWaitsForStarted(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer func(previous time.Duration) { shredSettle = previous }(shredSettle)
+	shredSettle = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "rsrdp-run")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "192.0.2.1.remmina")
+	Expect(ioutil.WriteFile(file, []byte("password=secret\n"), 0600)).To(Succeed())
+
+	started := make(chan struct{})
+	shredded, err := shredAfterRead(file, 0, started)
+	Expect(err).NotTo(HaveOccurred())
+
+	_, err = ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Consistently(shredded).ShouldNot(Receive())
+	Expect(file).To(BeAnExistingFile())
+
+	close(started)
+	Eventually(shredded).Should(Receive(BeNil()))
+	Expect(file).NotTo(BeAnExistingFile())
+}
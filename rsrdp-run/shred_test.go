@@ -0,0 +1,85 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestShred(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp-run")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "192.0.2.1.remmina")
+	Expect(ioutil.WriteFile(file, []byte("password=secret\n"), 0600)).To(Succeed())
+
+	Expect(shred(file)).To(Succeed())
+	Expect(file).NotTo(BeAnExistingFile())
+	Expect(shred(file)).To(Succeed())
+}
+
+func TestShredAfterReadWithDelay(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp-run")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "192.0.2.1.remmina")
+	Expect(ioutil.WriteFile(file, []byte("password=secret\n"), 0600)).To(Succeed())
+
+	shredded, err := shredAfterRead(file, 10*time.Millisecond, nil)
+	Expect(err).NotTo(HaveOccurred())
+	Eventually(shredded).Should(Receive(BeNil()))
+	Expect(file).NotTo(BeAnExistingFile())
+}
+
+func TestArmShredWithHandoff(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rsrdp-run")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "192.0.2.1.rdp")
+	Expect(ioutil.WriteFile(file, []byte("full address:s:192.0.2.1\n"), 0600)).To(Succeed())
+
+	defer func(previousFile string, previousDelay time.Duration, previousHandoff bool) {
+		*shredFile, *shredDelay, *handoff = previousFile, previousDelay, previousHandoff
+	}(*shredFile, *shredDelay, *handoff)
+	*shredFile, *shredDelay, *handoff = file, 10*time.Millisecond, true
+
+	// the executable exits without ever starting, so started is never closed
+	done := armShred(make(chan struct{}))
+	Eventually(done).Should(BeClosed())
+	Expect(file).NotTo(BeAnExistingFile())
+}
@@ -0,0 +1,116 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+)
+
+const tailLines = 10
+
+type Tail struct {
+	mutex sync.Mutex
+	lines [][]byte
+}
+
+func (tail *Tail) Write(p []byte) (int, error) {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if last := len(tail.lines) - 1; last >= 0 && !bytes.HasSuffix(tail.lines[last], []byte("\n")) {
+			tail.lines[last] = append(tail.lines[last], line...)
+		} else {
+			tail.lines = append(tail.lines, append([]byte(nil), line...))
+		}
+	}
+	if len(tail.lines) > tailLines {
+		tail.lines = tail.lines[len(tail.lines)-tailLines:]
+	}
+
+	return len(p), nil
+}
+
+func (tail *Tail) String() string {
+	tail.mutex.Lock()
+	defer tail.mutex.Unlock()
+
+	return string(bytes.Join(tail.lines, nil))
+}
+
+func exitStatus(err error) int {
+	if exitError, ok := err.(*exec.ExitError); ok {
+		if waitStatus, ok := exitError.Sys().(syscall.WaitStatus); ok {
+			if waitStatus.Signaled() {
+				return 128 + int(waitStatus.Signal())
+			}
+			return waitStatus.ExitStatus()
+		}
+	}
+	return 1
+}
+
+func writeStatus(file, status string) error {
+	if file == "" {
+		return nil
+	}
+
+	// rsrdp removes the status directory once it stops waiting for the status, so there is nobody left to tell
+	temporaryFile := file + ".tmp"
+	err := ioutil.WriteFile(temporaryFile, []byte(status), 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	err = os.Rename(temporaryFile, file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func writeStartedStatus(file string) error {
+	return writeStatus(file, "started\n")
+}
+
+func writeExitedStatus(file string, err error, tail *Tail) error {
+	if err == nil {
+		return writeStatus(file, fmt.Sprintf("exited 0\n%s", tail))
+	}
+	if _, ok := err.(*exec.ExitError); !ok {
+		return writeStatus(file, fmt.Sprintf("error %s\n", err))
+	}
+	return writeStatus(file, fmt.Sprintf("exited %d\n%s", exitStatus(err), tail))
+}
@@ -0,0 +1,285 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	secretPrefix   = "enc:v1:"
+	secretVariable = "RSRDP_PASSPHRASE"
+
+	secretSaltSize  = 16
+	secretNonceSize = 24
+	secretKeySize   = 32
+)
+
+type SecretBox struct {
+	passphrase     []byte
+	passphraseFunc func() ([]byte, error)
+	salt           []byte
+	keys           map[string]*[secretKeySize]byte
+}
+
+var configSecrets = newSecretBox(func() ([]byte, error) {
+	return readPassphrase(secretVariable, "Config passphrase: ")
+})
+
+func newSecretBox(passphraseFunc func() ([]byte, error)) *SecretBox {
+	return &SecretBox{passphraseFunc: passphraseFunc, keys: make(map[string]*[secretKeySize]byte)}
+}
+
+func isEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func isSecretConfigKey(key string) bool {
+	if !strings.HasPrefix(key, "login.environments.") {
+		return false
+	}
+	for _, suffix := range []string{".refresh_token", ".auth.password", ".auth.access_token", ".auth.instance_token"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func secretSalt(value string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding encrypted value: %s", err)
+	}
+	if len(sealed) < secretSaltSize+secretNonceSize+secretbox.Overhead {
+		return nil, fmt.Errorf("Error decoding encrypted value: value is truncated")
+	}
+	return sealed[:secretSaltSize], nil
+}
+
+// every value the box encrypts shares one salt so that reading a config file only derives one key
+func (box *SecretBox) Encrypt(plaintext string) (string, error) {
+	if box.salt == nil {
+		salt := make([]byte, secretSaltSize)
+		_, err := io.ReadFull(rand.Reader, salt)
+		if err != nil {
+			return "", fmt.Errorf("Error generating salt: %s", err)
+		}
+		box.salt = salt
+	}
+	var nonce [secretNonceSize]byte
+	_, err := io.ReadFull(rand.Reader, nonce[:])
+	if err != nil {
+		return "", fmt.Errorf("Error generating nonce: %s", err)
+	}
+
+	key, err := box.key(box.salt)
+	if err != nil {
+		return "", err
+	}
+
+	var sealed bytes.Buffer
+	sealed.Write(box.salt)
+	sealed.Write(nonce[:])
+	sealed.Write(secretbox.Seal(nil, []byte(plaintext), &nonce, key))
+
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed.Bytes()), nil
+}
+
+func (box *SecretBox) Decrypt(value string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("Error decoding encrypted value: %s", err)
+	}
+	if len(sealed) < secretSaltSize+secretNonceSize+secretbox.Overhead {
+		return "", fmt.Errorf("Error decoding encrypted value: value is truncated")
+	}
+
+	key, err := box.key(sealed[:secretSaltSize])
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [secretNonceSize]byte
+	copy(nonce[:], sealed[secretSaltSize:secretSaltSize+secretNonceSize])
+	plaintext, ok := secretbox.Open(nil, sealed[secretSaltSize+secretNonceSize:], &nonce, key)
+	if !ok {
+		return "", fmt.Errorf("Error decrypting value: wrong passphrase or corrupt value")
+	}
+
+	return string(plaintext), nil
+}
+
+func (box *SecretBox) key(salt []byte) (*[secretKeySize]byte, error) {
+	if key, ok := box.keys[string(salt)]; ok {
+		return key, nil
+	}
+
+	if box.passphrase == nil {
+		passphrase, err := box.passphraseFunc()
+		if err != nil {
+			return nil, err
+		}
+		box.passphrase = passphrase
+	}
+
+	derived, err := scrypt.Key(box.passphrase, salt, 1<<15, 8, 1, secretKeySize)
+	if err != nil {
+		return nil, fmt.Errorf("Error deriving config key: %s", err)
+	}
+
+	var key [secretKeySize]byte
+	copy(key[:], derived)
+	box.keys[string(salt)] = &key
+	return &key, nil
+}
+
+func decryptSettings(settings map[string]interface{}, path string) error {
+	for key, value := range settings {
+		keyPath := configJoinPath(path, key)
+		switch value := value.(type) {
+		case string:
+			if isEncryptedSecret(value) {
+				plaintext, err := configSecrets.Decrypt(value)
+				if err != nil {
+					return fmt.Errorf("%s: %s", keyPath, err)
+				}
+				settings[key] = plaintext
+			}
+		case map[string]interface{}:
+			err := decryptSettings(value, keyPath)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func configEncrypt(configFile string) error {
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+
+	if path, _ := document.EncryptedValue(); path == "" && os.Getenv(secretVariable) == "" {
+		passphrase, err := readPassphrase(secretVariable, "New config passphrase: ")
+		if err != nil {
+			return err
+		}
+		confirmation, err := readPassphrase(secretVariable, "Confirm config passphrase: ")
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(passphrase, confirmation) {
+			return fmt.Errorf("Error encrypting config file: passphrases do not match")
+		}
+		configSecrets.passphrase = passphrase
+	}
+
+	encrypted, err := encryptSecrets(document)
+	if err != nil {
+		return err
+	}
+
+	err = document.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Encrypted %d values in %s\n", encrypted, configFile)
+	return nil
+}
+
+func encryptSecrets(document *ConfigDocument) (int, error) {
+	if path, value := document.EncryptedValue(); path != "" {
+		// values encrypted with different passphrases could never all be read
+		_, err := configSecrets.Decrypt(value)
+		if err != nil {
+			return 0, fmt.Errorf("Error encrypting config file: %s: %s", path, err)
+		}
+		configSecrets.salt, _ = secretSalt(value)
+	}
+
+	encrypted := 0
+	err := document.WalkScalars(func(path string, value string) (string, error) {
+		if !isSecretConfigKey(path) || isEncryptedSecret(value) || value == "" {
+			return value, nil
+		}
+		encrypted++
+		return configSecrets.Encrypt(value)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error encrypting config file: %s", err)
+	}
+	return encrypted, nil
+}
+
+// encryptNewSecrets keeps an encrypted config file encrypted when secrets are written to it
+func encryptNewSecrets(document *ConfigDocument) error {
+	if path, _ := document.EncryptedValue(); path == "" {
+		return nil
+	}
+	_, err := encryptSecrets(document)
+	return err
+}
+
+func configDecrypt(configFile string) error {
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+
+	decrypted := 0
+	err = document.WalkScalars(func(path string, value string) (string, error) {
+		if !isEncryptedSecret(value) {
+			return value, nil
+		}
+		plaintext, err := configSecrets.Decrypt(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", path, err)
+		}
+		decrypted++
+		return plaintext, nil
+	})
+	if err != nil {
+		return fmt.Errorf("Error decrypting config file: %s", err)
+	}
+
+	err = document.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Decrypted %d values in %s\n", decrypted, configFile)
+	return nil
+}
@@ -0,0 +1,189 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	RegisterTestingT(t)
+
+	box := newSecretBox(func() ([]byte, error) { return []byte("secret"), nil })
+	encrypted, err := box.Encrypt("abcdef1234567890abcdef1234567890abcdef12")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(isEncryptedSecret(encrypted)).To(BeTrue())
+	Expect(encrypted).NotTo(ContainSubstring("abcdef1234567890"))
+
+	plaintext, err := box.Decrypt(encrypted)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(plaintext).To(Equal("abcdef1234567890abcdef1234567890abcdef12"))
+
+	wrong := newSecretBox(func() ([]byte, error) { return []byte("wrong"), nil })
+	_, err = wrong.Decrypt(encrypted)
+	Expect(err).To(MatchError("Error decrypting value: wrong passphrase or corrupt value"))
+}
+
+func TestConfigEncryptAndDecrypt(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Setenv(secretVariable, "secret")
+	defer os.Unsetenv(secretVariable)
+	defer func(previous *SecretBox) { configSecrets = previous }(configSecrets)
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+
+	dir, err := ioutil.TempDir("", "secret")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	content, err := ioutil.ReadFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(file, content, 0600)).To(Succeed())
+
+	Expect(configEncrypt(file)).To(Succeed())
+	content, err = ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).NotTo(ContainSubstring("abcdef1234567890abcdef1234567890abcdef12"))
+	Expect(string(content)).To(ContainSubstring("refresh_token: " + secretPrefix))
+
+	var salts [][]byte
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.WalkScalars(func(path, value string) (string, error) {
+		if isEncryptedSecret(value) {
+			salt, err := secretSalt(value)
+			Expect(err).NotTo(HaveOccurred())
+			salts = append(salts, salt)
+		}
+		return value, nil
+	})).To(Succeed())
+	Expect(len(salts)).To(BeNumerically(">", 1))
+	for _, salt := range salts {
+		Expect(salt).To(Equal(salts[0]))
+	}
+
+	err = readConfig(file, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environment.RefreshToken).To(Equal("abcdef1234567890abcdef1234567890abcdef12"))
+
+	Expect(configDecrypt(file)).To(Succeed())
+	content, err = ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(ContainSubstring("refresh_token: abcdef1234567890abcdef1234567890abcdef12"))
+}
+
+func TestConfigEncryptWithDifferentPassphrase(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Setenv(secretVariable, "secret")
+	defer os.Unsetenv(secretVariable)
+	defer func(previous *SecretBox) { configSecrets = previous }(configSecrets)
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+
+	encrypted, err := configSecrets.Encrypt("abcdef1234567890abcdef1234567890abcdef12")
+	Expect(err).NotTo(HaveOccurred())
+	dir, err := ioutil.TempDir("", "secret")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	content, err := ioutil.ReadFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	content = bytes.Replace(content, []byte("abcdef1234567890abcdef1234567890abcdef12"), []byte(encrypted), 1)
+	Expect(ioutil.WriteFile(file, content, 0600)).To(Succeed())
+
+	os.Setenv(secretVariable, "other")
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+	err = configEncrypt(file)
+	Expect(err).To(MatchError("Error encrypting config file: login.environments.production.refresh_token: Error decrypting value: wrong passphrase or corrupt value"))
+	after, err := ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(after).To(Equal(content))
+
+	os.Setenv(secretVariable, "secret")
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+	Expect(configEncrypt(file)).To(Succeed())
+	err = readConfig(file, "staging")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(config.environments["production"].RefreshToken).To(Equal("abcdef1234567890abcdef1234567890abcdef12"))
+	Expect(config.environment.RefreshToken).To(Equal("fedcba0987654321febcba0987654321fedcba09"))
+}
+
+func TestEnvAddWithEncryptedConfig(t *testing.T) {
+	RegisterTestingT(t)
+
+	os.Setenv(secretVariable, "secret")
+	defer os.Unsetenv(secretVariable)
+	defer func(previous *SecretBox) { configSecrets = previous }(configSecrets)
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+	if previous, ok := os.LookupEnv("RSRDP_REFRESH_TOKEN"); ok {
+		defer os.Setenv("RSRDP_REFRESH_TOKEN", previous)
+	} else {
+		defer os.Unsetenv("RSRDP_REFRESH_TOKEN")
+	}
+	os.Setenv("RSRDP_REFRESH_TOKEN", "0123456789abcdef0123456789abcdef01234567")
+
+	dir, err := ioutil.TempDir("", "secret")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, ".rsrdp.yml")
+	content, err := ioutil.ReadFile(exampleConfigFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(file, content, 0600)).To(Succeed())
+	Expect(configEncrypt(file)).To(Succeed())
+	document, err := loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	_, existing := document.EncryptedValue()
+	salt, err := secretSalt(existing)
+	Expect(err).NotTo(HaveOccurred())
+
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+	Expect(envAdd(file, "testing", "us-4.rightscale.com", 12345, false)).To(Succeed())
+	content, err = ioutil.ReadFile(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).NotTo(ContainSubstring("0123456789abcdef0123456789abcdef01234567"))
+	Expect(configSecrets.keys).To(HaveLen(1))
+
+	document, err = loadConfigDocument(file)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(document.WalkScalars(func(path, value string) (string, error) {
+		if path == "login.environments.testing.refresh_token" {
+			Expect(isEncryptedSecret(value)).To(BeTrue())
+			Expect(secretSalt(value)).To(Equal(salt))
+			plaintext, err := configSecrets.Decrypt(value)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plaintext).To(Equal("0123456789abcdef0123456789abcdef01234567"))
+		}
+		return value, nil
+	})).To(Succeed())
+
+	os.Setenv(secretVariable, "other")
+	configSecrets = newSecretBox(func() ([]byte, error) { return []byte(os.Getenv(secretVariable)), nil })
+	err = envAdd(file, "other", "us-4.rightscale.com", 12345, false)
+	Expect(err).To(MatchError(HavePrefix("Error encrypting config file: login.environments.")))
+}
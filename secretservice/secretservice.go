@@ -0,0 +1,134 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package secretservice
+
+import (
+	"fmt"
+
+	"github.com/godbus/dbus"
+)
+
+const (
+	ServiceName         = "org.freedesktop.secrets"
+	ServicePath         = dbus.ObjectPath("/org/freedesktop/secrets")
+	DefaultCollection   = dbus.ObjectPath("/org/freedesktop/secrets/aliases/default")
+	SessionCollection   = dbus.ObjectPath("/org/freedesktop/secrets/aliases/session")
+	ServiceInterface    = "org.freedesktop.Secret.Service"
+	CollectionInterface = "org.freedesktop.Secret.Collection"
+	ItemInterface       = "org.freedesktop.Secret.Item"
+	SessionInterface    = "org.freedesktop.Secret.Session"
+	ItemLabel           = ItemInterface + ".Label"
+	ItemAttributes      = ItemInterface + ".Attributes"
+	noPrompt            = dbus.ObjectPath("/")
+)
+
+type Secret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type SecretService struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+}
+
+func New(conn *dbus.Conn) (*SecretService, error) {
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err := conn.Object(ServiceName, ServicePath).Call(ServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening Secret Service session: %s", err)
+	}
+
+	return &SecretService{conn, session}, nil
+}
+
+func (service *SecretService) Close() error {
+	err := service.conn.Object(ServiceName, service.session).Call(SessionInterface+".Close", 0).Err
+	if err != nil {
+		return fmt.Errorf("Error closing Secret Service session: %s", err)
+	}
+	return nil
+}
+
+func (service *SecretService) CreateItem(collection dbus.ObjectPath, label string, attributes map[string]string, secret string) (dbus.ObjectPath, error) {
+	properties := map[string]dbus.Variant{
+		ItemLabel:      dbus.MakeVariant(label),
+		ItemAttributes: dbus.MakeVariant(attributes),
+	}
+	value := Secret{
+		Session:     service.session,
+		Parameters:  []byte{},
+		Value:       []byte(secret),
+		ContentType: "text/plain; charset=utf8",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err := service.conn.Object(ServiceName, collection).Call(CollectionInterface+".CreateItem", 0, properties, value, true).Store(&item, &prompt)
+	if err != nil {
+		return "", fmt.Errorf("Error creating Secret Service item: %s", err)
+	}
+	if prompt != noPrompt {
+		return "", fmt.Errorf("Error creating Secret Service item: collection is locked: %s", collection)
+	}
+
+	return item, nil
+}
+
+func (service *SecretService) DeleteItem(item dbus.ObjectPath) error {
+	var prompt dbus.ObjectPath
+	err := service.conn.Object(ServiceName, item).Call(ItemInterface+".Delete", 0).Store(&prompt)
+	if err != nil {
+		return fmt.Errorf("Error deleting Secret Service item: %s", err)
+	}
+	if prompt != noPrompt {
+		return fmt.Errorf("Error deleting Secret Service item: item is locked: %s", item)
+	}
+
+	return nil
+}
+
+func (service *SecretService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := service.conn.Object(ServiceName, ServicePath).Call(ServiceInterface+".SearchItems", 0, attributes).Store(&unlocked, &locked)
+	if err != nil {
+		return nil, fmt.Errorf("Error searching Secret Service items: %s", err)
+	}
+	if len(unlocked) == 0 && len(locked) != 0 {
+		return nil, fmt.Errorf("Error searching Secret Service items: items are locked: %s", locked)
+	}
+
+	return unlocked, nil
+}
+
+func (service *SecretService) GetSecret(item dbus.ObjectPath) (string, error) {
+	var secret Secret
+	err := service.conn.Object(ServiceName, item).Call(ItemInterface+".GetSecret", 0, service.session).Store(&secret)
+	if err != nil {
+		return "", fmt.Errorf("Error retrieving Secret Service secret: %s", err)
+	}
+
+	return string(secret.Value), nil
+}
@@ -0,0 +1,187 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package secretservice
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus"
+	. "github.com/onsi/gomega"
+)
+
+type fakeService struct {
+	mutex sync.Mutex
+	conn  *dbus.Conn
+	items map[dbus.ObjectPath]*fakeItem
+	next  int
+}
+
+type fakeItem struct {
+	service    *fakeService
+	path       dbus.ObjectPath
+	label      string
+	attributes map[string]string
+	secret     Secret
+}
+
+func (service *fakeService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []interface{}{algorithm})
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (service *fakeService) CreateItem(properties map[string]dbus.Variant, secret Secret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	service.next++
+	item := &fakeItem{
+		service:    service,
+		path:       dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", service.next)),
+		label:      properties[ItemLabel].Value().(string),
+		attributes: properties[ItemAttributes].Value().(map[string]string),
+		secret:     secret,
+	}
+	service.items[item.path] = item
+	service.conn.Export(item, item.path, ItemInterface)
+
+	return item.path, noPrompt, nil
+}
+
+func (service *fakeService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	service.mutex.Lock()
+	defer service.mutex.Unlock()
+
+	unlocked := make([]dbus.ObjectPath, 0)
+items:
+	for path, item := range service.items {
+		for key, value := range attributes {
+			if item.attributes[key] != value {
+				continue items
+			}
+		}
+		unlocked = append(unlocked, path)
+	}
+
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (service *fakeService) Close() *dbus.Error {
+	return nil
+}
+
+func (item *fakeItem) GetSecret(session dbus.ObjectPath) (Secret, *dbus.Error) {
+	return item.secret, nil
+}
+
+func (item *fakeItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	item.service.mutex.Lock()
+	defer item.service.mutex.Unlock()
+
+	delete(item.service.items, item.path)
+	item.service.conn.Export(nil, item.path, ItemInterface)
+
+	return noPrompt, nil
+}
+
+func startBus(t *testing.T) (string, func()) {
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not found in $PATH")
+	}
+
+	command := exec.Command(daemon, "--session", "--nofork", "--print-address")
+	stdout, err := command.StdoutPipe()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(command.Start()).To(Succeed())
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+
+	return strings.TrimSpace(address), func() {
+		command.Process.Kill()
+		command.Wait()
+	}
+}
+
+func connect(address string) *dbus.Conn {
+	conn, err := dbus.Dial(address)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(conn.Auth(nil)).To(Succeed())
+	Expect(conn.Hello()).To(Succeed())
+	return conn
+}
+
+func TestSecretService(t *testing.T) {
+	RegisterTestingT(t)
+
+	address, stop := startBus(t)
+	defer stop()
+
+	serviceConn := connect(address)
+	defer serviceConn.Close()
+	fake := &fakeService{conn: serviceConn, items: make(map[dbus.ObjectPath]*fakeItem)}
+	Expect(serviceConn.Export(fake, ServicePath, ServiceInterface)).To(Succeed())
+	Expect(serviceConn.Export(fake, SessionCollection, CollectionInterface)).To(Succeed())
+	Expect(serviceConn.Export(fake, "/org/freedesktop/secrets/session/1", SessionInterface)).To(Succeed())
+	reply, err := serviceConn.RequestName(ServiceName, dbus.NameFlagDoNotQueue)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(reply).To(Equal(dbus.RequestNameReplyPrimaryOwner))
+
+	clientConn := connect(address)
+	defer clientConn.Close()
+	service, err := New(clientConn)
+	Expect(err).NotTo(HaveOccurred())
+
+	attributes := map[string]string{"filename": "/run/user/1000/rsrdp123/192.0.2.1.remmina", "key": "password"}
+	item, err := service.CreateItem(SessionCollection, "RSRDP 192.0.2.1", attributes, "Pa$$w0rd!")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fake.items).To(HaveKey(item))
+	Expect(fake.items[item].label).To(Equal("RSRDP 192.0.2.1"))
+	Expect(fake.items[item].attributes).To(Equal(attributes))
+	Expect(string(fake.items[item].secret.Value)).To(Equal("Pa$$w0rd!"))
+
+	items, err := service.SearchItems(map[string]string{"key": "password"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(items).To(Equal([]dbus.ObjectPath{item}))
+
+	items, err = service.SearchItems(map[string]string{"key": "username"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(items).To(BeEmpty())
+
+	secret, err := service.GetSecret(item)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(secret).To(Equal("Pa$$w0rd!"))
+
+	Expect(service.DeleteItem(item)).To(Succeed())
+	Expect(fake.items).To(BeEmpty())
+	Expect(service.DeleteItem(item)).NotTo(Succeed())
+
+	Expect(service.Close()).To(Succeed())
+}
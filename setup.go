@@ -0,0 +1,182 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/rightscale/rsc.v4/rsapi"
+)
+
+const (
+	setupDefaultHost        = "us-3.rightscale.com"
+	setupDefaultEnvironment = "production"
+)
+
+func setup(configFile, environmentName, host string, account int) error {
+	reader := bufio.NewReader(os.Stdin)
+
+	if host == "" {
+		host = setupDefaultHost
+	}
+	host, err := setupPrompt(reader, "RightScale host", host)
+	if err != nil {
+		return err
+	}
+
+	var defaultAccount string
+	if account != 0 {
+		defaultAccount = strconv.Itoa(account)
+	}
+	accountString, err := setupPrompt(reader, "RightScale account ID", defaultAccount)
+	if err != nil {
+		return err
+	}
+	account, err = strconv.Atoi(accountString)
+	if err != nil {
+		return fmt.Errorf("Error parsing account ID: %s: %s", accountString, err)
+	}
+
+	refreshToken, err := readPassphrase("RSRDP_REFRESH_TOKEN", "RightScale refresh token: ")
+	if err != nil {
+		return err
+	}
+
+	environment := &Environment{Account: account, Host: host, RefreshToken: strings.TrimSpace(string(refreshToken))}
+	accounts, err := setupListAccounts(environment)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Accounts available with this refresh token:")
+	found := false
+	for _, id := range setupSortedAccounts(accounts) {
+		fmt.Printf("  %d  %s\n", id, accounts[id])
+		if id == account {
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("Error validating account: %d: refresh token does not have access to account", account)
+	}
+
+	if environmentName == "" {
+		environmentName = setupDefaultEnvironment
+	}
+	environmentName, err = setupPrompt(reader, "Environment name", environmentName)
+	if err != nil {
+		return err
+	}
+
+	answer, err := setupPrompt(reader, "Make this the default environment? (y/n)", "y")
+	if err != nil {
+		return err
+	}
+	makeDefault := strings.HasPrefix(strings.ToLower(answer), "y")
+
+	document, err := loadConfigDocument(configFile)
+	if err != nil {
+		return err
+	}
+	err = document.AddEnvironment(environmentName, environment, makeDefault)
+	if err != nil {
+		return err
+	}
+	err = encryptNewSecrets(document)
+	if err != nil {
+		return err
+	}
+	err = document.Save()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote environment %s to %s\n", environmentName, configFile)
+	return nil
+}
+
+func setupPrompt(reader *bufio.Reader, prompt, defaultValue string) (string, error) {
+	if defaultValue == "" {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s [%s]: ", prompt, defaultValue)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("Error reading %s: %s", strings.ToLower(prompt), err)
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		if defaultValue == "" {
+			return "", fmt.Errorf("Error reading %s: no value given", strings.ToLower(prompt))
+		}
+		return defaultValue, nil
+	}
+
+	return line, nil
+}
+
+func setupListAccounts(environment *Environment) (map[int]string, error) {
+	client15, err := environment.Client15()
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := client15.SessionLocator("/api/sessions").Accounts(rsapi.APIParams{})
+	if err != nil {
+		return nil, fmt.Errorf("Error validating refresh token: %s: %s", environment.Host, err)
+	}
+
+	names := make(map[int]string, len(accounts))
+	for _, account := range accounts {
+		for _, link := range account.Links {
+			if link["rel"] == "self" {
+				id, err := strconv.Atoi(path.Base(link["href"]))
+				if err == nil {
+					names[id] = account.Name
+				}
+				break
+			}
+		}
+	}
+
+	return names, nil
+}
+
+func setupSortedAccounts(accounts map[int]string) []int {
+	ids := make([]int, 0, len(accounts))
+	for id := range accounts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
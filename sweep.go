@@ -0,0 +1,81 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+const sweepPidFile = "rsrdp-run.pid"
+
+// only directories named by ioutil.TempDir for the "rsrdp" and "rsrdp-status" prefixes
+var sweepDirName = regexp.MustCompile(`^rsrdp(-status)?[0-9]+$`)
+
+// sweepMarkDir records the current process as the owner of a directory created by rsrdp; rsrdp-run replaces it
+// with its own PID when it takes over
+func sweepMarkDir(dir string) error {
+	return ioutil.WriteFile(filepath.Join(dir, sweepPidFile), []byte(strconv.Itoa(os.Getpid())), 0600)
+}
+
+func sweepTemporaryDirs(parent string) {
+	dirs, err := filepath.Glob(filepath.Join(parent, "rsrdp*"))
+	if err != nil {
+		log15.Warn("could not search for stale temporary directories", "error", err)
+		return
+	}
+
+	for _, dir := range dirs {
+		if !sweepDirName.MatchString(filepath.Base(dir)) || !sweepIsStale(dir) {
+			continue
+		}
+
+		err = os.RemoveAll(dir)
+		if err != nil {
+			log15.Warn("could not delete stale temporary directory", "dir", dir, "error", err)
+			continue
+		}
+		log15.Info("deleted stale temporary directory", "dir", dir)
+	}
+}
+
+func sweepIsStale(dir string) bool {
+	// never delete a directory without a PID file since nothing says rsrdp owns it
+	content, err := ioutil.ReadFile(filepath.Join(dir, sweepPidFile))
+	if err != nil {
+		return false
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return false
+	}
+
+	return !sweepProcessExists(pid)
+}
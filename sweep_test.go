@@ -0,0 +1,78 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSweepTemporaryDirs(t *testing.T) {
+	RegisterTestingT(t)
+
+	parent, err := ioutil.TempDir("", "sweep")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(parent)
+
+	running := filepath.Join(parent, "rsrdp123")
+	Expect(os.Mkdir(running, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(running, sweepPidFile), []byte(strconv.Itoa(os.Getpid())), 0600)).To(Succeed())
+
+	stale := filepath.Join(parent, "rsrdp456")
+	Expect(os.Mkdir(stale, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(stale, sweepPidFile), []byte("999999999"), 0600)).To(Succeed())
+
+	unowned := filepath.Join(parent, "rsrdp789")
+	Expect(os.Mkdir(unowned, 0700)).To(Succeed())
+
+	abandoned := filepath.Join(parent, "rsrdp012")
+	Expect(os.Mkdir(abandoned, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(abandoned, "10.0.0.1.rdp"), []byte("full address:s:10.0.0.1\n"), 0600)).To(Succeed())
+
+	status := filepath.Join(parent, "rsrdp-status345")
+	Expect(os.Mkdir(status, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(status, sweepPidFile), []byte("999999999"), 0600)).To(Succeed())
+
+	unrelated := filepath.Join(parent, "rsrdp-backup")
+	Expect(os.Mkdir(unrelated, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(unrelated, sweepPidFile), []byte("999999999"), 0600)).To(Succeed())
+
+	other := filepath.Join(parent, "other")
+	Expect(os.Mkdir(other, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(other, sweepPidFile), []byte("999999999"), 0600)).To(Succeed())
+
+	sweepTemporaryDirs(parent)
+
+	Expect(running).To(BeADirectory())
+	Expect(stale).NotTo(BeAnExistingFile())
+	Expect(unowned).To(BeADirectory())
+	Expect(abandoned).To(BeADirectory())
+	Expect(status).NotTo(BeAnExistingFile())
+	Expect(unrelated).To(BeADirectory())
+	Expect(other).To(BeADirectory())
+}
@@ -0,0 +1,385 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+// older versions kept the manifest in the profile directory itself
+const syncLegacyManifestFile = ".rsrdp-sync"
+
+var syncReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "\x00", "_")
+
+func syncProfiles(directory, format string, prune, private bool, index int, prompt bool, username string) error {
+	err := os.MkdirAll(directory, 0700)
+	if err != nil {
+		return fmt.Errorf("Error creating profile directory: %s", err)
+	}
+
+	written := make(map[string]bool)
+	failed := make([]string, 0)
+	failedAccounts := make(map[string]bool)
+
+	for _, name := range config.environmentNames() {
+		environment := config.environments[name]
+		err = syncEnvironment(directory, format, environment, private, index, prompt, username, written)
+		if err != nil {
+			log15.Error("could not sync environment", "environment", name, "error", err)
+			failed = append(failed, name)
+			failedAccounts[strconv.Itoa(environment.Account)] = true
+		}
+	}
+
+	manifest, err := syncManifestFile(directory)
+	if err != nil {
+		return err
+	}
+	previous, err := syncReadManifest(manifest, directory)
+	if err != nil {
+		return err
+	}
+	legacyManifest := filepath.Join(directory, syncLegacyManifestFile)
+	if previous == nil {
+		previous, err = syncReadManifest(legacyManifest, directory)
+		if err != nil {
+			return err
+		}
+	}
+	for _, file := range previous {
+		if written[file] {
+			continue
+		}
+		// keep the profiles of environments that could not be synced this time
+		if relative, err := filepath.Rel(directory, file); err == nil && failedAccounts[strings.SplitN(relative, string(filepath.Separator), 2)[0]] {
+			written[file] = true
+			continue
+		}
+		if prune {
+			err = syncPruneProfile(file)
+			if err != nil {
+				return err
+			}
+		} else {
+			written[file] = true
+		}
+	}
+
+	err = syncWriteManifest(manifest, directory, written)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(legacyManifest)
+	if err != nil && !os.IsNotExist(err) {
+		log15.Warn("could not delete old sync manifest", "file", legacyManifest, "error", err)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Error syncing environments: %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+func syncEnvironment(directory, format string, environment *Environment, private bool, index int, prompt bool, username string, written map[string]bool) error {
+	instances, err := syncGetInstances(environment)
+	if err != nil && environment.followShardRedirect() {
+		instances, err = syncGetInstances(environment)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, instance := range instances {
+		if instance.OsPlatform != "windows" {
+			continue
+		}
+		// only fetch the Administrator password of the instances profiles are written for
+		if !prompt {
+			instance, err = urlGetInstanceFromInstanceHref(instance.Href(), environment, prompt)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = syncWriteProfiles(directory, format, instance, private, index, prompt, username, written)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func syncGetInstances(environment *Environment) ([]*Instance, error) {
+	instances := make([]*Instance, 0)
+
+	servers, err := environment.Resolver().Servers()
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		var currentInstanceHref string
+		for _, link := range server.Links {
+			if link["rel"] == "current_instance" {
+				currentInstanceHref = link["href"]
+				break
+			}
+		}
+		if currentInstanceHref == "" {
+			continue
+		}
+
+		instance, err := urlGetInstanceFromInstanceHref(currentInstanceHref, environment, true)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, instance)
+	}
+
+	arrays, err := environment.Resolver().ServerArrays()
+	if err != nil {
+		return nil, err
+	}
+	for _, array := range arrays {
+		var arrayHref string
+		for _, link := range array.Links {
+			if link["rel"] == "self" {
+				arrayHref = link["href"]
+				break
+			}
+		}
+
+		arrayInstances, err := urlGetInstancesFromServerArrayHref(arrayHref, environment, true)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, arrayInstances...)
+	}
+
+	return instances, nil
+}
+
+// syncName makes a deployment or instance name safe to use as a single path element.
+func syncName(name string) string {
+	name = syncReplacer.Replace(name)
+	if name == "." || name == ".." {
+		return strings.Repeat("_", len(name))
+	}
+	return name
+}
+
+func syncWriteProfiles(directory, format string, instance *Instance, private bool, index int, prompt bool, username string, written map[string]bool) error {
+	ipAddress, err := instance.IpAddress(private, index)
+	if err != nil {
+		log15.Warn("skipping instance without IP address", "instance", instance.Href(), "error", err)
+		return nil
+	}
+
+	username, domain, err := usernameForInstance(instance, username)
+	if err != nil {
+		return err
+	}
+
+	deploymentName, err := instance.DeploymentName()
+	if err != nil {
+		return err
+	}
+	if deploymentName == "" {
+		deploymentName = "No Deployment"
+	}
+
+	dir := filepath.Join(directory, strconv.Itoa(instance.Environment.Account), syncName(deploymentName))
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("Error creating profile directory: %s", err)
+	}
+
+	name := syncName(instance.Name)
+	if name == "" {
+		name = ipAddress
+	}
+	if written[filepath.Join(dir, name+".rdp")] || written[filepath.Join(dir, name+".remmina")] {
+		name += "-" + syncName(instance.ResourceUid)
+	}
+
+	if format == "rdp" || format == "both" {
+		file := filepath.Join(dir, name+".rdp")
+		err = syncWriteFile(file, func(writer io.Writer) error {
+			return rdpWriteFile(writer, instance, ipAddress, username, domain, false)
+		})
+		if err != nil {
+			return err
+		}
+		log15.Info("wrote profile", "instance", instance.Href(), "file", file)
+		written[file] = true
+	}
+
+	if format == "remmina" || format == "both" {
+		if !prompt {
+			instance.AdminPassword, err = instance.Password()
+			if err != nil {
+				return err
+			}
+		}
+
+		parameters, err := remminaProfileParameters(instance, ipAddress, username, domain, !prompt, false)
+		if err != nil {
+			return err
+		}
+
+		file := filepath.Join(dir, name+".remmina")
+		err = syncWriteFile(file, func(writer io.Writer) error {
+			return remminaWriteProfile(writer, parameters)
+		})
+		if err != nil {
+			return err
+		}
+		log15.Info("wrote profile", "instance", instance.Href(), "file", file)
+		written[file] = true
+	}
+
+	return nil
+}
+
+func syncWriteFile(name string, write func(io.Writer) error) error {
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("Error creating profile: %s", err)
+	}
+
+	err = write(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Error writing profile: %s: %s", name, err)
+	}
+
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("Error writing profile: %s: %s", name, err)
+	}
+
+	return nil
+}
+
+// syncManifestFile returns where the list of profiles synced into directory is kept, which is in the state
+// directory so the profile directory only holds profiles
+func syncManifestFile(directory string) (string, error) {
+	directory, err := filepath.Abs(directory)
+	if err != nil {
+		return "", fmt.Errorf("Error finding sync manifest: %s", err)
+	}
+	stateDir, err := defaultStateDir()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(directory))
+	return filepath.Join(stateDir, "sync", hex.EncodeToString(sum[:])), nil
+}
+
+func syncReadManifest(manifest, directory string) ([]string, error) {
+	file, err := os.Open(manifest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("Error reading sync manifest: %s", err)
+	}
+	defer file.Close()
+
+	files := make([]string, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		// never let the manifest point pruning outside the profile directory
+		relative := filepath.Clean(line)
+		if filepath.IsAbs(relative) || filepath.VolumeName(relative) != "" || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+			log15.Warn("ignoring sync manifest entry outside the profile directory", "entry", line)
+			continue
+		}
+		files = append(files, filepath.Join(directory, relative))
+	}
+	err = scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading sync manifest: %s", err)
+	}
+
+	return files, nil
+}
+
+func syncWriteManifest(manifest, directory string, written map[string]bool) error {
+	files := make([]string, 0, len(written))
+	for file := range written {
+		relative, err := filepath.Rel(directory, file)
+		if err != nil {
+			return fmt.Errorf("Error writing sync manifest: %s", err)
+		}
+		files = append(files, relative)
+	}
+	sort.Strings(files)
+
+	err := os.MkdirAll(filepath.Dir(manifest), 0700)
+	if err != nil {
+		return fmt.Errorf("Error writing sync manifest: %s", err)
+	}
+
+	return syncWriteFile(manifest, func(writer io.Writer) error {
+		for _, file := range files {
+			_, err := fmt.Fprintln(writer, file)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func syncPruneProfile(file string) error {
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error pruning profile: %s", err)
+	}
+	log15.Info("pruned profile", "file", file)
+
+	// remove the deployment and account directories too once they are empty
+	deploymentDir := filepath.Dir(file)
+	if os.Remove(deploymentDir) == nil {
+		os.Remove(filepath.Dir(deploymentDir))
+	}
+
+	return nil
+}
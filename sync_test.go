@@ -0,0 +1,198 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/spf13/viper"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+func TestSyncManifest(t *testing.T) {
+	RegisterTestingT(t)
+
+	directory, err := ioutil.TempDir("", "rsrdp-sync")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(directory)
+	manifest := filepath.Join(directory, "state", "sync", "manifest")
+
+	files, err := syncReadManifest(manifest, directory)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(BeNil())
+
+	written := map[string]bool{
+		filepath.Join(directory, "12345", "Production", "web.rdp"):     true,
+		filepath.Join(directory, "12345", "Production", "web.remmina"): true,
+		filepath.Join(directory, "67890", "Staging", "db.rdp"):         true,
+	}
+	err = syncWriteManifest(manifest, directory, written)
+	Expect(err).NotTo(HaveOccurred())
+
+	files, err = syncReadManifest(manifest, directory)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(Equal([]string{
+		filepath.Join(directory, "12345", "Production", "web.rdp"),
+		filepath.Join(directory, "12345", "Production", "web.remmina"),
+		filepath.Join(directory, "67890", "Staging", "db.rdp"),
+	}))
+}
+
+func TestSyncPruneProfile(t *testing.T) {
+	RegisterTestingT(t)
+
+	directory, err := ioutil.TempDir("", "rsrdp-sync")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(directory)
+
+	deploymentDir := filepath.Join(directory, "12345", "Production")
+	Expect(os.MkdirAll(deploymentDir, 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(deploymentDir, "web.rdp"), nil, 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(deploymentDir, "db.rdp"), nil, 0600)).To(Succeed())
+
+	Expect(syncPruneProfile(filepath.Join(deploymentDir, "web.rdp"))).To(Succeed())
+	Expect(filepath.Join(deploymentDir, "web.rdp")).NotTo(BeAnExistingFile())
+	Expect(filepath.Join(deploymentDir, "db.rdp")).To(BeAnExistingFile())
+
+	Expect(syncPruneProfile(filepath.Join(deploymentDir, "db.rdp"))).To(Succeed())
+	Expect(filepath.Join(directory, "12345")).NotTo(BeAnExistingFile())
+	Expect(directory).To(BeADirectory())
+}
+
+func TestSyncReadManifestWithUnsafeEntries(t *testing.T) {
+	RegisterTestingT(t)
+
+	directory, err := ioutil.TempDir("", "rsrdp-sync")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(directory)
+
+	manifest := "12345/Production/web.rdp\n../../x\n..\n/etc/passwd\n12345/../../y\n12345/./Production/../Staging/db.rdp\n"
+	Expect(ioutil.WriteFile(filepath.Join(directory, syncLegacyManifestFile), []byte(manifest), 0600)).To(Succeed())
+
+	files, err := syncReadManifest(filepath.Join(directory, syncLegacyManifestFile), directory)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(Equal([]string{
+		filepath.Join(directory, "12345", "Production", "web.rdp"),
+		filepath.Join(directory, "12345", "Staging", "db.rdp"),
+	}))
+}
+
+func TestSyncProfilesWithFailingEnvironment(t *testing.T) {
+	RegisterTestingT(t)
+
+	directory, err := ioutil.TempDir("", "rsrdp-sync")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(directory)
+
+	if value, ok := os.LookupEnv("XDG_STATE_HOME"); ok {
+		defer os.Setenv("XDG_STATE_HOME", value)
+	} else {
+		defer os.Unsetenv("XDG_STATE_HOME")
+	}
+	os.Setenv("XDG_STATE_HOME", filepath.Join(directory, "state"))
+	manifest, err := syncManifestFile(directory)
+	Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(manifest)
+
+	kept := filepath.Join(directory, "12345", "Production", "web.rdp")
+	pruned := filepath.Join(directory, "67890", "Staging", "db.rdp")
+	Expect(os.MkdirAll(filepath.Dir(kept), 0700)).To(Succeed())
+	Expect(os.MkdirAll(filepath.Dir(pruned), 0700)).To(Succeed())
+	Expect(ioutil.WriteFile(kept, nil, 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(pruned, nil, 0600)).To(Succeed())
+	// start from a manifest in the profile directory like older versions wrote
+	legacyManifest := filepath.Join(directory, syncLegacyManifestFile)
+	Expect(syncWriteManifest(legacyManifest, directory, map[string]bool{kept: true, pruned: true})).To(Succeed())
+
+	windows := &cm15.Instance{
+		Links: []map[string]string{
+			{"rel": "self", "href": "/api/clouds/1/instances/WIN"},
+			{"rel": "deployment", "href": "/api/deployments/1"},
+		},
+		Name:              "..",
+		OsPlatform:        "windows",
+		PublicIpAddresses: []string{"192.0.2.1"},
+		AdminPassword:     "windows-password",
+	}
+	linux := &cm15.Instance{
+		Links:             []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/LNX"}},
+		Name:              "linux",
+		OsPlatform:        "linux",
+		PublicIpAddresses: []string{"192.0.2.2"},
+		AdminPassword:     "linux-password",
+	}
+	member := &cm15.Instance{
+		Links:             []map[string]string{{"rel": "self", "href": "/api/clouds/1/instances/ARR"}},
+		Name:              "array #1",
+		OsPlatform:        "windows",
+		PublicIpAddresses: []string{"192.0.2.3"},
+		AdminPassword:     "array-password",
+	}
+	resolver := &testingResolver{
+		instances: map[string]*cm15.Instance{
+			"/api/clouds/1/instances/WIN": windows,
+			"/api/clouds/1/instances/LNX": linux,
+			"/api/clouds/1/instances/ARR": member,
+		},
+		current: map[string][]string{"/api/server_arrays/1/current_instances": {"/api/clouds/1/instances/ARR"}},
+		serverList: []*cm15.Server{
+			{Links: []map[string]string{{"rel": "current_instance", "href": "/api/clouds/1/instances/WIN"}}},
+			{Links: []map[string]string{{"rel": "current_instance", "href": "/api/clouds/1/instances/LNX"}}},
+			{Links: []map[string]string{}},
+		},
+		arrayList: []*cm15.ServerArray{{Links: []map[string]string{{"rel": "self", "href": "/api/server_arrays/1"}}}},
+		arrays: map[string]*cm15.ServerArray{
+			"/api/server_arrays/1": {Links: []map[string]string{{"rel": "current_instances", "href": "/api/server_arrays/1/current_instances"}}},
+		},
+		deployments: map[string]*cm15.Deployment{"/api/deployments/1": {Name: ".."}},
+	}
+
+	defer func(previous Config) { config = previous }(config)
+	config = Config{Viper: viper.New(), environments: map[string]*Environment{
+		"production": {Account: 12345, Host: "us-3.rightscale.com", RefreshToken: testingEnvironment.RefreshToken, resolver: &testingResolver{}},
+		"staging":    {Account: 67890, Host: "us-4.rightscale.com", RefreshToken: testingEnvironment.RefreshToken, resolver: resolver},
+	}}
+
+	err = syncProfiles(directory, "rdp", true, false, 0, false, "")
+	Expect(err).To(MatchError("Error syncing environments: production"))
+	Expect(kept).To(BeAnExistingFile())
+	Expect(pruned).NotTo(BeAnExistingFile())
+	Expect(resolver.sensitive).To(Equal(map[string]int{"/api/clouds/1/instances/WIN": 1, "/api/clouds/1/instances/ARR": 1}))
+
+	written := []string{
+		filepath.Join(directory, "67890", "No Deployment", "array #1.rdp"),
+		filepath.Join(directory, "67890", "__", "__.rdp"),
+	}
+	for _, file := range written {
+		Expect(file).To(BeARegularFile())
+	}
+
+	files, err := syncReadManifest(manifest, directory)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(Equal(append([]string{kept}, written...)))
+	Expect(legacyManifest).NotTo(BeAnExistingFile())
+}
@@ -27,7 +27,10 @@ import (
 	neturl "net/url"
 	"regexp"
 	"strconv"
+	"time"
 
+	"gopkg.in/inconshreveable/log15.v2"
+	"gopkg.in/rightscale/rsc.v4/cm15"
 	"gopkg.in/rightscale/rsc.v4/rsapi"
 )
 
@@ -50,76 +53,126 @@ func urlsToInstances(urls []string, prompt bool) ([]*Instance, error) {
 			return nil, fmt.Errorf("Error parsing URL: %s", err)
 		}
 
-		switch {
-		case instanceHref.MatchString(parsedUrl.Path):
-			instance, err := urlGetInstanceFromInstanceHref(parsedUrl.Path, config.environment, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, instance)
-		case serverHref.MatchString(parsedUrl.Path):
-			instance, err := urlGetInstanceFromServerHref(parsedUrl.Path, config.environment, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, instance)
-		case serverArrayHref.MatchString(parsedUrl.Path):
-			arrayInstances, err := urlGetInstancesFromServerArrayHref(parsedUrl.Path, config.environment, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, arrayInstances...)
-		case instancePage.MatchString(parsedUrl.Path):
-			instance, err := urlGetInstanceFromInstancePage(parsedUrl, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, instance)
-		case serverPage.MatchString(parsedUrl.Path):
-			instance, err := urlGetInstanceFromServerPage(parsedUrl, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, instance)
-		case serverArrayPage.MatchString(parsedUrl.Path):
-			arrayInstances, err := urlGetInstancesFromServerArrayPage(parsedUrl, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, arrayInstances...)
-		case redirectPage.MatchString(parsedUrl.Path):
-			arrayInstances, err := urlGetInstancesFromRedirectPage(parsedUrl, prompt)
-			if err != nil {
-				return nil, err
-			}
-			instances = append(instances, arrayInstances...)
-		default:
-			return nil, fmt.Errorf("Error parsing URL: %s: unsupported URL format", url)
+		environment, err := urlEnvironment(parsedUrl)
+		if err != nil {
+			return nil, err
+		}
+
+		urlInstances, err := urlToInstances(parsedUrl, environment, prompt)
+		if err != nil && environment.followShardRedirect() {
+			urlInstances, err = urlToInstances(parsedUrl, environment, prompt)
 		}
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, urlInstances...)
 	}
 
 	return instances, nil
 }
 
-func urlGetInstanceFromInstanceHref(href string, environment *Environment, prompt bool) (*Instance, error) {
-	client15 := environment.Client15()
-	params := rsapi.APIParams{}
-	if !prompt {
-		params["view"] = "sensitive"
+func urlEnvironment(url *neturl.URL) (*Environment, error) {
+	var submatches []string
+	switch {
+	case instanceHref.MatchString(url.Path), serverHref.MatchString(url.Path), serverArrayHref.MatchString(url.Path):
+		return config.environment, nil
+	case instancePage.MatchString(url.Path):
+		submatches = instancePage.FindStringSubmatch(url.Path)
+	case serverPage.MatchString(url.Path):
+		submatches = serverPage.FindStringSubmatch(url.Path)
+	case serverArrayPage.MatchString(url.Path):
+		submatches = serverArrayPage.FindStringSubmatch(url.Path)
+	case redirectPage.MatchString(url.Path):
+		submatches = redirectPage.FindStringSubmatch(url.Path)
+	default:
+		return nil, fmt.Errorf("Error parsing URL: %s: unsupported URL format", url)
+	}
+
+	account, _ := strconv.ParseInt(submatches[1], 0, 0)
+	return config.getEnvironment(int(account), url.Host)
+}
+
+func urlToInstances(url *neturl.URL, environment *Environment, prompt bool) ([]*Instance, error) {
+	var instance *Instance
+	var err error
+
+	switch {
+	case instanceHref.MatchString(url.Path):
+		instance, err = urlGetInstanceFromInstanceHref(url.Path, environment, prompt)
+	case serverHref.MatchString(url.Path):
+		instance, err = urlGetInstanceFromServerHref(url.Path, environment, prompt)
+	case serverArrayHref.MatchString(url.Path):
+		return urlGetInstancesFromServerArrayHref(url.Path, environment, prompt)
+	case instancePage.MatchString(url.Path):
+		instance, err = urlGetInstanceFromInstancePage(url, environment, prompt)
+	case serverPage.MatchString(url.Path):
+		instance, err = urlGetInstanceFromServerPage(url, environment, prompt)
+	case serverArrayPage.MatchString(url.Path):
+		return urlGetInstancesFromServerArrayPage(url, environment, prompt)
+	case redirectPage.MatchString(url.Path):
+		return urlGetInstancesFromRedirectPage(url, environment, prompt)
+	default:
+		return nil, fmt.Errorf("Error parsing URL: %s: unsupported URL format", url)
+	}
+	if err != nil {
+		return nil, err
 	}
-	instance, err := client15.InstanceLocator(href).Show(params)
+
+	return []*Instance{instance}, nil
+}
+
+func urlGetInstanceFromInstanceHref(href string, environment *Environment, prompt bool) (*Instance, error) {
+	instance, err := environment.Resolver().Instance(href, !prompt && cache == nil)
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving instance: %s: %s", href, err)
+		return nil, err
+	}
+
+	if !prompt && cache != nil {
+		instance, err = urlGetCachedPassword(instance, environment)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Instance{instance, environment}, nil
 }
 
+// urlGetCachedPassword fills in the Administrator password of an instance from the cache,
+// only retrieving the sensitive view of the instance when the cached password is stale.
+func urlGetCachedPassword(instance *cm15.Instance, environment *Environment) (*cm15.Instance, error) {
+	href := (&Instance{instance, environment}).Href()
+
+	var updatedAt time.Time
+	if instance.UpdatedAt != nil {
+		updatedAt = instance.UpdatedAt.Time
+	}
+
+	password, ok := cache.Get(href, instance.ResourceUid, updatedAt)
+	if ok {
+		log15.Debug("using cached admin password", "instance", href)
+		instance.AdminPassword = password
+		return instance, nil
+	}
+
+	instance, err := environment.Resolver().Instance(href, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.AdminPassword != "" {
+		err = cache.Put(href, instance.ResourceUid, updatedAt, instance.AdminPassword)
+		if err != nil {
+			log15.Warn("could not cache admin password", "instance", href, "error", err)
+		}
+	}
+
+	return instance, nil
+}
+
 func urlGetInstanceFromServerHref(href string, environment *Environment, prompt bool) (*Instance, error) {
-	client15 := environment.Client15()
-	server, err := client15.ServerLocator(href).Show(rsapi.APIParams{})
+	server, err := environment.Resolver().Server(href)
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving server: %s: %s", href, err)
+		return nil, err
 	}
 
 	var currentInstanceHref string
@@ -137,10 +190,9 @@ func urlGetInstanceFromServerHref(href string, environment *Environment, prompt
 }
 
 func urlGetInstancesFromServerArrayHref(href string, environment *Environment, prompt bool) ([]*Instance, error) {
-	client15 := environment.Client15()
-	array, err := client15.ServerArrayLocator(href).Show(rsapi.APIParams{})
+	array, err := environment.Resolver().ServerArray(href)
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving array: %s: %s", href, err)
+		return nil, err
 	}
 
 	var currentInstancesHref string
@@ -151,53 +203,42 @@ func urlGetInstancesFromServerArrayHref(href string, environment *Environment, p
 		}
 	}
 
-	params := rsapi.APIParams{}
-	if !prompt {
-		params["view"] = "sensitive"
-	}
-	currentInstances, err := client15.InstanceLocator(currentInstancesHref).Index(params)
+	currentInstances, err := environment.Resolver().Instances(currentInstancesHref, !prompt && cache == nil)
 	if err != nil {
-		return nil, fmt.Errorf("Error retrieving array instances: %s: %s", currentInstancesHref, err)
+		return nil, err
 	}
 
 	instances := make([]*Instance, len(currentInstances))
 	for index, instance := range currentInstances {
+		if !prompt && cache != nil {
+			instance, err = urlGetCachedPassword(instance, environment)
+			if err != nil {
+				return nil, err
+			}
+		}
 		instances[index] = &Instance{instance, environment}
 	}
 
 	return instances, nil
 }
 
-func urlGetInstanceFromInstancePage(url *neturl.URL, prompt bool) (*Instance, error) {
+func urlGetInstanceFromInstancePage(url *neturl.URL, environment *Environment, prompt bool) (*Instance, error) {
 	submatches := instancePage.FindStringSubmatch(url.Path)
-	account, _ := strconv.ParseInt(submatches[1], 0, 0)
 	cloud, _ := strconv.ParseInt(submatches[2], 0, 0)
 	legacyId, _ := strconv.ParseInt(submatches[3], 0, 0)
 
-	environment, err := config.getEnvironment(int(account), url.Host)
-	if err != nil {
-		return nil, err
-	}
-
 	return urlGetInstanceFromLegacyId(int(cloud), int(legacyId), environment, prompt)
 }
 
-func urlGetInstanceFromServerPage(url *neturl.URL, prompt bool) (*Instance, error) {
+func urlGetInstanceFromServerPage(url *neturl.URL, environment *Environment, prompt bool) (*Instance, error) {
 	submatches := serverPage.FindStringSubmatch(url.Path)
-	account, _ := strconv.ParseInt(submatches[1], 0, 0)
 	href := "/api/servers/" + submatches[2]
 
-	environment, err := config.getEnvironment(int(account), url.Host)
-	if err != nil {
-		return nil, err
-	}
-
 	instanceId := url.Query().Get("instance_id")
 	if instanceId != "" {
-		client15 := environment.Client15()
-		server, err := client15.ServerLocator(href).Show(rsapi.APIParams{})
+		server, err := environment.Resolver().Server(href)
 		if err != nil {
-			return nil, fmt.Errorf("Error retrieving server: %s: %s", href, err)
+			return nil, err
 		}
 
 		var nextInstanceHref string
@@ -224,28 +265,15 @@ func urlGetInstanceFromServerPage(url *neturl.URL, prompt bool) (*Instance, erro
 	return urlGetInstanceFromServerHref(href, environment, prompt)
 }
 
-func urlGetInstancesFromServerArrayPage(url *neturl.URL, prompt bool) ([]*Instance, error) {
+func urlGetInstancesFromServerArrayPage(url *neturl.URL, environment *Environment, prompt bool) ([]*Instance, error) {
 	submatches := serverArrayPage.FindStringSubmatch(url.Path)
-	account, _ := strconv.ParseInt(submatches[1], 0, 0)
 	href := "/api/server_arrays/" + submatches[2]
 
-	environment, err := config.getEnvironment(int(account), url.Host)
-	if err != nil {
-		return nil, err
-	}
-
 	return urlGetInstancesFromServerArrayHref(href, environment, prompt)
 }
 
-func urlGetInstancesFromRedirectPage(url *neturl.URL, prompt bool) ([]*Instance, error) {
-	submatches := redirectPage.FindStringSubmatch(url.Path)
-	account, _ := strconv.ParseInt(submatches[1], 0, 0)
-
-	environment, err := config.getEnvironment(int(account), url.Host)
-	if err != nil {
-		return nil, err
-	}
-
+func urlGetInstancesFromRedirectPage(url *neturl.URL, environment *Environment, prompt bool) ([]*Instance, error) {
+	var err error
 	query := url.Query()
 	resourceType := query.Get("resource_type")
 	resourceUri := query.Get("resource_uri")
@@ -272,7 +300,10 @@ func urlGetInstancesFromRedirectPage(url *neturl.URL, prompt bool) ([]*Instance,
 }
 
 func urlGetInstanceFromLegacyId(cloud, legacyId int, environment *Environment, prompt bool) (*Instance, error) {
-	client16 := environment.Client16()
+	client16, err := environment.Client16()
+	if err != nil {
+		return nil, err
+	}
 	instances, err := client16.InstanceLocator(fmt.Sprintf("/api/clouds/%d/instances", cloud)).Index(rsapi.APIParams{})
 	if err != nil {
 		return nil, err
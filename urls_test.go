@@ -0,0 +1,190 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/httpclient"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	RegisterTestingT(t)
+
+	Expect(normalizeHost("us-3.rightscale.com")).To(Equal("us-3.rightscale.com"))
+	Expect(normalizeHost("US-3.RightScale.com")).To(Equal("us-3.rightscale.com"))
+	Expect(normalizeHost("us-3.rightscale.com.")).To(Equal("us-3.rightscale.com"))
+	Expect(normalizeHost("us-3.rightscale.com:443")).To(Equal("us-3.rightscale.com"))
+	Expect(normalizeHost("us-3.rightscale.com:8443")).To(Equal("us-3.rightscale.com:8443"))
+	Expect(normalizeHost("https://us-4.rightscale.com/")).To(Equal("us-4.rightscale.com"))
+}
+
+func TestEnvironmentTrustsHost(t *testing.T) {
+	RegisterTestingT(t)
+
+	environment := &Environment{Host: "rightscale.example.com", HostAliases: []string{"RS.Example.com"}}
+	Expect(environment.trustsHost("rightscale.example.com")).To(BeTrue())
+	Expect(environment.trustsHost("rs.example.com")).To(BeTrue())
+	Expect(environment.trustsHost("us-4.rightscale.com")).To(BeTrue())
+	Expect(environment.trustsHost("my.rightscale.com")).To(BeTrue())
+	Expect(environment.trustsHost("evil.example")).To(BeFalse())
+	Expect(environment.trustsHost("rightscale.com.evil.example")).To(BeFalse())
+	Expect(environment.trustsHost("evilrightscale.com")).To(BeFalse())
+}
+
+func withUrlTestingConfig(test func()) {
+	defer func(previous Config) { config = previous }(config)
+	config = Config{environments: map[string]*Environment{
+		"production": {Account: 12345, Host: "us-3.rightscale.com", Auth: testingAccessToken},
+		"staging":    {Account: 67890, Host: "us-4.rightscale.com", HostAliases: []string{"Staging.Example.com"}, Auth: testingAccessToken},
+		"telstra":    {Account: 13579, Host: "telstra-10.rightscale.com", Auth: testingAccessToken},
+	}}
+	config.environment = config.environments["production"]
+	test()
+}
+
+func TestUrlEnvironment(t *testing.T) {
+	RegisterTestingT(t)
+
+	withUrlTestingConfig(func() {
+		environments := map[string]string{
+			"https://us-4.rightscale.com/api/clouds/1/instances/ABC123":                                      "production",
+			"https://us-4.rightscale.com/api/servers/123":                                                    "production",
+			"https://us-4.rightscale.com/api/deployments/456/servers/123":                                    "production",
+			"https://us-4.rightscale.com/api/server_arrays/123":                                              "production",
+			"https://us-4.rightscale.com/api/deployments/456/server_arrays/123":                              "production",
+			"https://us-3.rightscale.com/acct/12345/clouds/1/instances/789":                                  "production",
+			"https://us-3.rightscale.com/acct/12345/servers/123":                                             "production",
+			"https://us-3.rightscale.com/acct/12345/servers/123?instance_id=789":                             "production",
+			"https://us-3.rightscale.com/acct/12345/server_arrays/123":                                       "production",
+			"https://us-3.rightscale.com/acct/12345/redirect_to_ui_uri?resource_type=server&resource_uri=/x": "production",
+			"https://US-4.RightScale.com./acct/67890/servers/123":                                            "staging",
+			"https://us-4.rightscale.com:443/acct/67890/server_arrays/123":                                   "staging",
+			"https://staging.example.com/acct/67890/servers/123":                                             "staging",
+			"https://my.rightscale.com/acct/67890/clouds/1/instances/789":                                    "staging",
+			"https://my.rightscale.com/acct/13579/redirect_to_ui_uri?resource_type=instance&resource_uri=/x": "telstra",
+			"https://telstra-10.rightscale.com/acct/13579/server_arrays/123":                                 "telstra",
+		}
+		for url, name := range environments {
+			parsedUrl, err := neturl.Parse(url)
+			Expect(err).NotTo(HaveOccurred())
+			environment, err := urlEnvironment(parsedUrl)
+			Expect(err).NotTo(HaveOccurred(), url)
+			Expect(environment).To(BeIdenticalTo(config.environments[name]), url)
+		}
+
+		parsedUrl, _ := neturl.Parse("https://us-3.rightscale.com/acct/67890/servers/123")
+		_, err := urlEnvironment(parsedUrl)
+		Expect(err).To(MatchError("Error finding environment for account/host: 67890 us-3.rightscale.com"))
+
+		parsedUrl, _ = neturl.Parse("https://staging.example.com/acct/12345/servers/123")
+		_, err = urlEnvironment(parsedUrl)
+		Expect(err).To(MatchError("Error finding environment for account/host: 12345 staging.example.com"))
+
+		parsedUrl, _ = neturl.Parse("https://us-3.rightscale.com/acct/12345/deployments/123")
+		_, err = urlEnvironment(parsedUrl)
+		Expect(err).To(MatchError("Error parsing URL: https://us-3.rightscale.com/acct/12345/deployments/123: unsupported URL format"))
+	})
+}
+
+func TestUrlsToInstancesWithUnsupportedUrl(t *testing.T) {
+	RegisterTestingT(t)
+
+	withUrlTestingConfig(func() {
+		_, err := urlsToInstances([]string{"https://us-3.rightscale.com/acct/12345/dashboard"}, false)
+		Expect(err).To(MatchError("Error parsing URL: https://us-3.rightscale.com/acct/12345/dashboard: unsupported URL format"))
+	})
+}
+
+func TestEnvironmentFollowShardRedirect(t *testing.T) {
+	RegisterTestingT(t)
+
+	shard := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/servers" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer shard.Close()
+	shardURL, _ := neturl.Parse(shard.URL)
+
+	wrong := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/deployments" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.Redirect(w, r, shard.URL+r.URL.Path, http.StatusMovedPermanently)
+	}))
+	defer wrong.Close()
+	wrongURL, _ := neturl.Parse(wrong.URL)
+
+	defer func(previous bool) { httpclient.Insecure = previous }(httpclient.Insecure)
+	httpclient.Insecure = true
+	defer func(previous string) { shardScheme = previous }(shardScheme)
+	shardScheme = "http"
+
+	get := func(environment *Environment, path string) int {
+		client15, err := environment.Client15()
+		Expect(err).NotTo(HaveOccurred())
+		request, err := client15.BuildHTTPRequest("GET", path, "1.5", nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		response, err := client15.PerformRequest(request)
+		Expect(err).NotTo(HaveOccurred())
+		response.Body.Close()
+		return response.StatusCode
+	}
+
+	environment := &Environment{Account: 12345, Host: wrongURL.Host, HostAliases: []string{shardURL.Host}, Auth: testingAccessToken}
+	Expect(environment.followShardRedirect()).To(BeFalse())
+	Expect(get(environment, "/api/deployments")).To(Equal(http.StatusForbidden))
+	Expect(environment.followShardRedirect()).To(BeFalse())
+	Expect(environment.Host).To(Equal(wrongURL.Host))
+	Expect(environment.client15).NotTo(BeNil())
+
+	Expect(get(environment, "/api/servers")).To(Equal(http.StatusMovedPermanently))
+	Expect(environment.followShardRedirect()).To(BeTrue())
+	Expect(environment.Host).To(Equal(shardURL.Host))
+	Expect(environment.client15).To(BeNil())
+	Expect(get(environment, "/api/servers")).To(Equal(http.StatusOK))
+	client15, err := environment.Client15()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(client15.Host).To(Equal(shardURL.Host))
+
+	Expect(get(environment, "/api/deployments")).To(Equal(http.StatusNotFound))
+	Expect(environment.followShardRedirect()).To(BeFalse())
+
+	environment = &Environment{Account: 12345, Host: shardURL.Host, Auth: testingAccessToken}
+	Expect(get(environment, "/api/deployments")).To(Equal(http.StatusNotFound))
+	Expect(environment.followShardRedirect()).To(BeFalse())
+	Expect(environment.Host).To(Equal(shardURL.Host))
+
+	environment = &Environment{Account: 12345, Host: wrongURL.Host, Auth: testingAccessToken}
+	Expect(get(environment, "/api/servers")).To(Equal(http.StatusMovedPermanently))
+	Expect(environment.followShardRedirect()).To(BeFalse())
+	Expect(environment.Host).To(Equal(wrongURL.Host))
+}
@@ -0,0 +1,138 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const defaultUsername = "Administrator"
+
+type UsernameRule struct {
+	Environment string
+	Deployment  string
+	Server      string
+	Tag         string
+	Username    string
+	Domain      string
+}
+
+func usernameForInstance(instance *Instance, username string) (string, string, error) {
+	if username != "" {
+		domain, user := usernameSplit(username)
+		return user, domain, nil
+	}
+
+	var rules []UsernameRule
+	err := config.UnmarshalKey("usernames", &rules)
+	if err != nil {
+		return "", "", fmt.Errorf("Error reading username rules: %s", err)
+	}
+
+	for _, rule := range rules {
+		ok, err := rule.Match(instance)
+		if err != nil {
+			return "", "", err
+		}
+		if !ok {
+			continue
+		}
+
+		domain, user := usernameSplit(rule.Username)
+		if rule.Domain != "" {
+			domain = rule.Domain
+		}
+		if user == "" {
+			user = defaultUsername
+		}
+		return user, domain, nil
+	}
+
+	return defaultUsername, "", nil
+}
+
+func usernameSplit(username string) (string, string) {
+	if index := strings.Index(username, "\\"); index != -1 {
+		return username[:index], username[index+1:]
+	}
+	return "", username
+}
+
+func (rule *UsernameRule) Match(instance *Instance) (bool, error) {
+	if rule.Environment != "" {
+		environment, ok := config.environments[rule.Environment]
+		// environments discovered for other accounts are clones of the configured one
+		if !ok || (environment != instance.Environment && environment != instance.Environment.source) {
+			return false, nil
+		}
+	}
+
+	if rule.Server != "" {
+		serverName, err := instance.ServerName()
+		if err != nil {
+			return false, err
+		}
+		ok, err := path.Match(rule.Server, serverName)
+		if err != nil {
+			return false, fmt.Errorf("Error matching server name pattern: %s: %s", rule.Server, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	if rule.Deployment != "" {
+		deploymentName, err := instance.DeploymentName()
+		if err != nil {
+			return false, err
+		}
+		ok, err := path.Match(rule.Deployment, deploymentName)
+		if err != nil {
+			return false, fmt.Errorf("Error matching deployment name pattern: %s: %s", rule.Deployment, err)
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	if rule.Tag != "" {
+		tags, err := instance.Tags()
+		if err != nil {
+			return false, err
+		}
+		for _, tag := range tags {
+			ok, err := path.Match(rule.Tag, tag)
+			if err != nil {
+				return false, fmt.Errorf("Error matching tag pattern: %s: %s", rule.Tag, err)
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	return true, nil
+}
@@ -0,0 +1,158 @@
+// The MIT License (MIT)
+//
+// Copyright (c) 2015 Douglas Thrift
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/rightscale/rsc.v4/cm15"
+)
+
+func TestUsernameForInstanceWithFlag(t *testing.T) {
+	RegisterTestingT(t)
+
+	err := readConfig(exampleConfigFile, "")
+	Expect(err).NotTo(HaveOccurred())
+
+	instance := &Instance{&cm15.Instance{Name: "svc-1"}, config.environments["staging"]}
+	username, domain, err := usernameForInstance(instance, "CORP\\bob")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(username).To(Equal("bob"))
+	Expect(domain).To(Equal("CORP"))
+
+	username, domain, err = usernameForInstance(instance, "Administrator")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(username).To(Equal("Administrator"))
+	Expect(domain).To(BeEmpty())
+}
+
+func TestUsernameForInstanceWithRules(t *testing.T) {
+	RegisterTestingT(t)
+
+	err := readConfig(exampleConfigFile, "")
+	Expect(err).NotTo(HaveOccurred())
+
+	instance := &Instance{&cm15.Instance{Name: "svc-1"}, config.environments["staging"]}
+	username, domain, err := usernameForInstance(instance, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(username).To(Equal("svc_deploy"))
+	Expect(domain).To(BeEmpty())
+
+	instance = &Instance{&cm15.Instance{Name: "web-1"}, config.environments["staging"]}
+	username, domain, err = usernameForInstance(instance, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(username).To(Equal(defaultUsername))
+	Expect(domain).To(BeEmpty())
+}
+
+func TestUsernameRuleMatch(t *testing.T) {
+	RegisterTestingT(t)
+
+	err := readConfig(exampleConfigFile, "")
+	Expect(err).NotTo(HaveOccurred())
+
+	environment := *config.environments["production"]
+	environment.resolver = &testingResolver{
+		arrays:      map[string]*cm15.ServerArray{"/api/server_arrays/1": {Name: "svc-array"}},
+		deployments: map[string]*cm15.Deployment{"/api/deployments/2": {Name: "Corp Web"}},
+		tags:        map[string][]string{"/api/clouds/1/instances/ABC": {"rs_agent:type=right_link_lite", "rs_login:domain=corp"}},
+	}
+	config.environments["production"] = &environment
+	instance := &Instance{&cm15.Instance{
+		Links: []map[string]string{
+			{"rel": "self", "href": "/api/clouds/1/instances/ABC"},
+			{"rel": "parent", "href": "/api/server_arrays/1"},
+			{"rel": "deployment", "href": "/api/deployments/2"},
+		},
+		Name: "svc-array #1",
+	}, &environment}
+
+	for _, test := range []struct {
+		rule  UsernameRule
+		match bool
+		err   string
+	}{
+		{UsernameRule{}, true, ""},
+		{UsernameRule{Environment: "production"}, true, ""},
+		{UsernameRule{Environment: "staging"}, false, ""},
+		{UsernameRule{Environment: "missing"}, false, ""},
+		{UsernameRule{Server: "svc-*"}, true, ""},
+		{UsernameRule{Server: "svc-array #*"}, false, ""},
+		{UsernameRule{Server: "["}, false, "Error matching server name pattern: [: syntax error in pattern"},
+		{UsernameRule{Deployment: "Corp *"}, true, ""},
+		{UsernameRule{Deployment: "Test *"}, false, ""},
+		{UsernameRule{Deployment: "["}, false, "Error matching deployment name pattern: [: syntax error in pattern"},
+		{UsernameRule{Tag: "rs_login:domain=*"}, true, ""},
+		{UsernameRule{Tag: "rs_login:user=*"}, false, ""},
+		{UsernameRule{Tag: "["}, false, "Error matching tag pattern: [: syntax error in pattern"},
+		{UsernameRule{Environment: "production", Server: "svc-*", Deployment: "Corp *", Tag: "rs_login:*"}, true, ""},
+		{UsernameRule{Environment: "production", Server: "svc-*", Deployment: "Test *", Tag: "rs_login:*"}, false, ""},
+	} {
+		ok, err := test.rule.Match(instance)
+		if test.err != "" {
+			Expect(err).To(MatchError(test.err))
+		} else {
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(ok).To(Equal(test.match), "%+v", test.rule)
+	}
+
+	instance.Links[1]["href"] = "/api/servers/3"
+	_, err = (&UsernameRule{Server: "svc-*"}).Match(instance)
+	Expect(err).To(MatchError("Error retrieving server: /api/servers/3: 404 Not Found"))
+	ok, err := (&UsernameRule{Deployment: "Corp *"}).Match(instance)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ok).To(BeTrue())
+}
+
+func TestUsernameRuleMatchWithDiscoveredAccount(t *testing.T) {
+	RegisterTestingT(t)
+
+	err := readConfig(exampleConfigFile, "")
+	Expect(err).NotTo(HaveOccurred())
+
+	discovered, err := config.environments["production"].forAccount(12346, "us-3.rightscale.com")
+	Expect(err).NotTo(HaveOccurred())
+	again, err := discovered.forAccount(12347, "us-4.rightscale.com")
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, environment := range []*Environment{discovered, again} {
+		instance := &Instance{&cm15.Instance{Name: "web-1"}, environment}
+		ok, err := (&UsernameRule{Environment: "production"}).Match(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		ok, err = (&UsernameRule{Environment: "staging"}).Match(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	}
+}
+
+func TestInstanceServerNameWithoutParent(t *testing.T) {
+	RegisterTestingT(t)
+
+	instance := &Instance{&cm15.Instance{Name: "web-1"}, &testingEnvironment}
+	name, err := instance.ServerName()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(name).To(Equal("web-1"))
+}